@@ -0,0 +1,103 @@
+#include "extension.h"
+
+static void emulator_free(void *pointer) {
+  bubbletea_emulator_t *emulator = (bubbletea_emulator_t *)pointer;
+
+  if (emulator->handle != 0) {
+    tea_emulator_free(emulator->handle);
+  }
+
+  xfree(emulator);
+}
+
+static size_t emulator_memsize(const void *pointer) {
+  return sizeof(bubbletea_emulator_t);
+}
+
+const rb_data_type_t emulator_type = {
+  .wrap_struct_name = "Bubbletea::Emulator",
+  .function = {
+    .dmark = NULL,
+    .dfree = emulator_free,
+    .dsize = emulator_memsize,
+  },
+  .flags = RUBY_TYPED_FREE_IMMEDIATELY
+};
+
+static VALUE emulator_alloc(VALUE klass) {
+  bubbletea_emulator_t *emulator = ALLOC(bubbletea_emulator_t);
+  emulator->handle = 0;
+  return TypedData_Wrap_Struct(klass, &emulator_type, emulator);
+}
+
+static VALUE emulator_initialize(int argc, VALUE *argv, VALUE self) {
+  GET_EMULATOR(self, emulator);
+
+  VALUE width, height;
+  rb_scan_args(argc, argv, "02", &width, &height);
+
+  emulator->handle = tea_emulator_new(NIL_P(width) ? 80 : NUM2INT(width), NIL_P(height) ? 24 : NUM2INT(height));
+
+  if (emulator->handle == 0) {
+    rb_raise(rb_eIOError, "could not create emulator");
+  }
+
+  return self;
+}
+
+static VALUE emulator_write(VALUE self, VALUE data) {
+  GET_EMULATOR(self, emulator);
+
+  Check_Type(data, T_STRING);
+  tea_emulator_write(emulator->handle, RSTRING_PTR(data), (int)RSTRING_LEN(data));
+
+  return self;
+}
+
+static VALUE emulator_send_input(VALUE self, VALUE data) {
+  GET_EMULATOR(self, emulator);
+
+  Check_Type(data, T_STRING);
+  tea_emulator_send_input(emulator->handle, RSTRING_PTR(data), (int)RSTRING_LEN(data));
+
+  return self;
+}
+
+static VALUE emulator_resize(VALUE self, VALUE width, VALUE height) {
+  GET_EMULATOR(self, emulator);
+  tea_emulator_resize(emulator->handle, NUM2INT(width), NUM2INT(height));
+  return Qnil;
+}
+
+static VALUE emulator_screen_text(VALUE self) {
+  GET_EMULATOR(self, emulator);
+
+  char *text = tea_emulator_screen_text(emulator->handle);
+  VALUE rb_text = rb_utf8_str_new_cstr(text);
+  tea_free(text);
+
+  return rb_text;
+}
+
+static VALUE emulator_cell_at(VALUE self, VALUE x, VALUE y) {
+  GET_EMULATOR(self, emulator);
+  return parse_json_reply(tea_emulator_cell_at(emulator->handle, NUM2INT(x), NUM2INT(y)));
+}
+
+static VALUE emulator_state(VALUE self) {
+  GET_EMULATOR(self, emulator);
+  return parse_json_reply(tea_emulator_state(emulator->handle));
+}
+
+void Init_bubbletea_emulator(void) {
+  cEmulator = rb_define_class_under(mBubbletea, "Emulator", rb_cObject);
+
+  rb_define_alloc_func(cEmulator, emulator_alloc);
+  rb_define_method(cEmulator, "initialize", emulator_initialize, -1);
+  rb_define_method(cEmulator, "write", emulator_write, 1);
+  rb_define_method(cEmulator, "send_input", emulator_send_input, 1);
+  rb_define_method(cEmulator, "resize", emulator_resize, 2);
+  rb_define_method(cEmulator, "screen_text", emulator_screen_text, 0);
+  rb_define_method(cEmulator, "cell_at", emulator_cell_at, 2);
+  rb_define_method(cEmulator, "state", emulator_state, 0);
+}
@@ -2,6 +2,7 @@
 
 VALUE mBubbletea;
 VALUE cProgram;
+VALUE cEmulator;
 
 static VALUE bubbletea_upstream_version_rb(VALUE self) {
   char *version = tea_upstream_version();
@@ -21,20 +22,37 @@ static VALUE bubbletea_version_rb(VALUE self) {
 }
 
 static VALUE bubbletea_is_tty_rb(VALUE self) {
-  return tea_terminal_is_tty() ? Qtrue : Qfalse;
+  return tea_terminal_is_tty(0) ? Qtrue : Qfalse;
 }
 
 static VALUE bubbletea_clear_screen_rb(VALUE self) {
-  tea_terminal_clear_screen();
+  tea_terminal_clear_screen(0);
   return Qnil;
 }
 
 static VALUE bubbletea_set_window_title_rb(VALUE self, VALUE title) {
   Check_Type(title, T_STRING);
-  tea_terminal_set_window_title(StringValueCStr(title));
+  tea_terminal_set_window_title(0, StringValueCStr(title));
   return Qnil;
 }
 
+static VALUE bubbletea_compose_rb(VALUE self, VALUE base, VALUE layers) {
+  Check_Type(base, T_STRING);
+  Check_Type(layers, T_ARRAY);
+
+  VALUE layers_json = rb_funcall(layers, rb_intern("to_json"), 0);
+  char *view = tea_compose(StringValueCStr(base), StringValueCStr(layers_json));
+
+  if (view == NULL) {
+    rb_raise(rb_eArgError, "invalid layers: %" PRIsVALUE, rb_inspect(layers));
+  }
+
+  VALUE rb_view = rb_utf8_str_new_cstr(view);
+  tea_free(view);
+
+  return rb_view;
+}
+
 static VALUE bubbletea_get_key_name_rb(VALUE self, VALUE key_type) {
   Check_Type(key_type, T_FIXNUM);
   char *name = tea_get_key_name(FIX2INT(key_type));
@@ -49,6 +67,7 @@ __attribute__((__visibility__("default"))) void Init_bubbletea(void) {
   mBubbletea = rb_define_module("Bubbletea");
 
   Init_bubbletea_program();
+  Init_bubbletea_emulator();
 
   rb_define_singleton_method(mBubbletea, "upstream_version", bubbletea_upstream_version_rb, 0);
   rb_define_singleton_method(mBubbletea, "version", bubbletea_version_rb, 0);
@@ -56,4 +75,5 @@ __attribute__((__visibility__("default"))) void Init_bubbletea(void) {
   rb_define_singleton_method(mBubbletea, "clear_screen", bubbletea_clear_screen_rb, 0);
   rb_define_singleton_method(mBubbletea, "_set_window_title", bubbletea_set_window_title_rb, 1);
   rb_define_singleton_method(mBubbletea, "get_key_name", bubbletea_get_key_name_rb, 1);
+  rb_define_singleton_method(mBubbletea, "compose", bubbletea_compose_rb, 2);
 }
@@ -6,8 +6,10 @@
 
 extern VALUE mBubbletea;
 extern VALUE cProgram;
+extern VALUE cEmulator;
 
 extern const rb_data_type_t program_type;
+extern const rb_data_type_t emulator_type;
 
 typedef struct {
   unsigned long long handle;
@@ -17,6 +19,17 @@ typedef struct {
   bubbletea_program_t *program; \
   TypedData_Get_Struct(self, bubbletea_program_t, &program_type, program)
 
+typedef struct {
+  unsigned long long handle;
+} bubbletea_emulator_t;
+
+#define GET_EMULATOR(self, emulator) \
+  bubbletea_emulator_t *emulator; \
+  TypedData_Get_Struct(self, bubbletea_emulator_t, &emulator_type, emulator)
+
+VALUE parse_json_reply(char *json);
+
 void Init_bubbletea_program(void);
+void Init_bubbletea_emulator(void);
 
 #endif
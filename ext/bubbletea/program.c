@@ -30,8 +30,156 @@ static VALUE program_alloc(VALUE klass) {
   return TypedData_Wrap_Struct(klass, &program_type, program);
 }
 
-static VALUE program_initialize(VALUE self) {
+/* Device methods */
+
+/* Returns the file descriptor for an IO or Integer target, or -1 for :buffer */
+static int output_target_fd(VALUE target) {
+  if (target == ID2SYM(rb_intern("buffer"))) {
+    return -1;
+  }
+
+  if (rb_respond_to(target, rb_intern("fileno"))) {
+    return NUM2INT(rb_funcall(target, rb_intern("fileno"), 0));
+  }
+
+  if (RB_INTEGER_TYPE_P(target)) {
+    return NUM2INT(target);
+  }
+
+  rb_raise(rb_eArgError, "output must be an IO, a file descriptor or :buffer");
+}
+
+static VALUE output_string(char *output, int length) {
+  VALUE rb_output = rb_str_new(output, length);
+  tea_free(output);
+
+  return rb_output;
+}
+
+static VALUE program_set_output(VALUE self, VALUE target) {
+  GET_PROGRAM(self, program);
+
+  int fd = output_target_fd(target);
+  int result = fd < 0 ? tea_program_set_output_buffer(program->handle) : tea_program_set_output_fd(program->handle, fd);
+
+  if (result != 0) {
+    rb_raise(rb_eIOError, "could not use output %" PRIsVALUE, rb_inspect(target));
+  }
+
+  return Qnil;
+}
+
+static VALUE program_read_output(VALUE self) {
+  GET_PROGRAM(self, program);
+
+  int length;
+  char *output = tea_program_read_output(program->handle, &length);
+
+  return output_string(output, length);
+}
+
+static VALUE program_output_stats(VALUE self) {
   GET_PROGRAM(self, program);
+  return parse_json_reply(tea_program_output_stats(program->handle));
+}
+
+static VALUE program_attach_emulator(VALUE self, VALUE emulator) {
+  GET_PROGRAM(self, program);
+  GET_EMULATOR(emulator, vt);
+
+  if (tea_emulator_attach(program->handle, vt->handle) != 0) {
+    rb_raise(rb_eIOError, "could not attach emulator");
+  }
+
+  /* Keep the emulator alive for as long as the program uses it */
+  rb_ivar_set(self, rb_intern("@emulator"), emulator);
+
+  return Qnil;
+}
+
+static VALUE program_set_input(VALUE self, VALUE target) {
+  GET_PROGRAM(self, program);
+
+  int fd;
+
+  if (rb_respond_to(target, rb_intern("fileno"))) {
+    fd = NUM2INT(rb_funcall(target, rb_intern("fileno"), 0));
+  } else if (RB_INTEGER_TYPE_P(target)) {
+    fd = NUM2INT(target);
+  } else {
+    rb_raise(rb_eArgError, "input must be an IO or a file descriptor");
+  }
+
+  if (tea_program_set_input_fd(program->handle, fd) != 0) {
+    rb_raise(rb_eIOError, "could not use input %" PRIsVALUE " (is the input reader running?)", rb_inspect(target));
+  }
+
+  return Qnil;
+}
+
+static VALUE program_open_tty(VALUE self, VALUE path) {
+  GET_PROGRAM(self, program);
+
+  Check_Type(path, T_STRING);
+
+  if (tea_program_open_tty(program->handle, StringValueCStr(path)) != 0) {
+    rb_raise(rb_eIOError, "could not open terminal %" PRIsVALUE " (is the input reader running?)", path);
+  }
+
+  return Qnil;
+}
+
+/* Returns which standard streams were replaced by the controlling terminal */
+static VALUE program_redirected_streams(VALUE self) {
+  GET_PROGRAM(self, program);
+
+  int streams = tea_terminal_redirected_streams(program->handle);
+  VALUE rb_streams = rb_ary_new();
+
+  if (streams & 1) {
+    rb_ary_push(rb_streams, ID2SYM(rb_intern("input")));
+  }
+
+  if (streams & 2) {
+    rb_ary_push(rb_streams, ID2SYM(rb_intern("output")));
+  }
+
+  return rb_streams;
+}
+
+/*
+ * Program.new(input: nil, output: nil, tty: nil) reads from and writes to the
+ * given devices instead of stdin and stdout. tty is a terminal path such as
+ * "/dev/pts/3" used for both; output can also be :buffer or an Emulator.
+ */
+static VALUE program_initialize(int argc, VALUE *argv, VALUE self) {
+  GET_PROGRAM(self, program);
+
+  VALUE options;
+  rb_scan_args(argc, argv, ":", &options);
+
+  if (!NIL_P(options)) {
+    ID keys[3] = { rb_intern("input"), rb_intern("output"), rb_intern("tty") };
+    VALUE values[3];
+
+    rb_get_kwargs(options, keys, 0, 3, values);
+
+    if (values[2] != Qundef && !NIL_P(values[2])) {
+      program_open_tty(self, values[2]);
+    }
+
+    if (values[0] != Qundef && !NIL_P(values[0])) {
+      program_set_input(self, values[0]);
+    }
+
+    if (values[1] != Qundef && !NIL_P(values[1])) {
+      if (rb_obj_is_kind_of(values[1], cEmulator)) {
+        program_attach_emulator(self, values[1]);
+      } else {
+        program_set_output(self, values[1]);
+      }
+    }
+  }
 
   tea_terminal_init(program->handle);
 
@@ -40,6 +188,40 @@ static VALUE program_initialize(VALUE self) {
 
 /* Terminal control methods */
 
+static VALUE program_tty(VALUE self) {
+  GET_PROGRAM(self, program);
+  return tea_terminal_is_tty(program->handle) ? Qtrue : Qfalse;
+}
+
+static VALUE program_output_tty(VALUE self) {
+  GET_PROGRAM(self, program);
+  return tea_terminal_output_is_tty(program->handle) ? Qtrue : Qfalse;
+}
+
+static VALUE program_write(VALUE self, VALUE data) {
+  GET_PROGRAM(self, program);
+
+  Check_Type(data, T_STRING);
+  tea_terminal_write(program->handle, RSTRING_PTR(data), (int)RSTRING_LEN(data));
+
+  return Qnil;
+}
+
+static VALUE program_set_window_title(VALUE self, VALUE title) {
+  GET_PROGRAM(self, program);
+
+  Check_Type(title, T_STRING);
+  tea_terminal_set_window_title(program->handle, StringValueCStr(title));
+
+  return Qnil;
+}
+
+static VALUE program_clear_screen(VALUE self) {
+  GET_PROGRAM(self, program);
+  tea_terminal_clear_screen(program->handle);
+  return Qnil;
+}
+
 static VALUE program_enter_raw_mode(VALUE self) {
   GET_PROGRAM(self, program);
   return tea_terminal_enter_raw_mode(program->handle) == 0 ? Qtrue : Qfalse;
@@ -116,17 +298,202 @@ static VALUE program_disable_report_focus(VALUE self) {
   return Qnil;
 }
 
+static VALUE program_enable_in_band_resize(VALUE self) {
+  GET_PROGRAM(self, program);
+  tea_terminal_enable_in_band_resize(program->handle);
+  return Qnil;
+}
+
+static VALUE program_disable_in_band_resize(VALUE self) {
+  GET_PROGRAM(self, program);
+  tea_terminal_disable_in_band_resize(program->handle);
+  return Qnil;
+}
+
+static VALUE program_push_kitty_keyboard(VALUE self, VALUE flags) {
+  GET_PROGRAM(self, program);
+  tea_terminal_push_kitty_keyboard(program->handle, NUM2INT(flags));
+  return Qnil;
+}
+
+static VALUE program_pop_kitty_keyboard(VALUE self) {
+  GET_PROGRAM(self, program);
+  tea_terminal_pop_kitty_keyboard(program->handle);
+  return Qnil;
+}
+
+static VALUE program_enable_application_cursor(VALUE self) {
+  GET_PROGRAM(self, program);
+  tea_terminal_enable_application_cursor(program->handle);
+  return Qnil;
+}
+
+static VALUE program_disable_application_cursor(VALUE self) {
+  GET_PROGRAM(self, program);
+  tea_terminal_disable_application_cursor(program->handle);
+  return Qnil;
+}
+
+static VALUE program_enable_application_keypad(VALUE self) {
+  GET_PROGRAM(self, program);
+  tea_terminal_enable_application_keypad(program->handle);
+  return Qnil;
+}
+
+static VALUE program_disable_application_keypad(VALUE self) {
+  GET_PROGRAM(self, program);
+  tea_terminal_disable_application_keypad(program->handle);
+  return Qnil;
+}
+
 static VALUE program_terminal_size(VALUE self) {
   GET_PROGRAM(self, program);
-  int width, height;
+  int width, height, pixel_width, pixel_height;
 
-  if (tea_terminal_get_size(program->handle, &width, &height) == 0) {
+  if (tea_terminal_get_size(program->handle, &width, &height, &pixel_width, &pixel_height) == 0) {
     return rb_ary_new_from_args(2, INT2NUM(width), INT2NUM(height));
   }
 
   return Qnil;
 }
 
+static VALUE program_window_size(VALUE self) {
+  GET_PROGRAM(self, program);
+  int width, height, pixel_width, pixel_height;
+
+  if (tea_terminal_get_size(program->handle, &width, &height, &pixel_width, &pixel_height) != 0) {
+    return Qnil;
+  }
+
+  VALUE size = rb_hash_new();
+  rb_hash_aset(size, ID2SYM(rb_intern("width")), INT2NUM(width));
+  rb_hash_aset(size, ID2SYM(rb_intern("height")), INT2NUM(height));
+  rb_hash_aset(size, ID2SYM(rb_intern("pixel_width")), INT2NUM(pixel_width));
+  rb_hash_aset(size, ID2SYM(rb_intern("pixel_height")), INT2NUM(pixel_height));
+
+  return size;
+}
+
+/* Terminal query methods */
+
+VALUE parse_json_reply(char *json) {
+  if (json == NULL || json[0] == '\0') {
+    tea_free(json);
+    return Qnil;
+  }
+
+  VALUE rb_json = rb_utf8_str_new_cstr(json);
+  tea_free(json);
+
+  VALUE rb_json_module = rb_const_get(rb_cObject, rb_intern("JSON"));
+
+  return rb_funcall(rb_json_module, rb_intern("parse"), 1, rb_json);
+}
+
+static VALUE program_query_cursor_position(VALUE self, VALUE timeout_ms) {
+  GET_PROGRAM(self, program);
+  int x, y;
+
+  if (tea_terminal_query_cursor_position(program->handle, NUM2INT(timeout_ms), &x, &y) == 0) {
+    return rb_ary_new_from_args(2, INT2NUM(x), INT2NUM(y));
+  }
+
+  return Qnil;
+}
+
+static VALUE program_query_device_attributes(VALUE self, VALUE timeout_ms) {
+  GET_PROGRAM(self, program);
+  return parse_json_reply(tea_terminal_query_device_attributes(program->handle, NUM2INT(timeout_ms)));
+}
+
+static VALUE program_query_secondary_device_attributes(VALUE self, VALUE timeout_ms) {
+  GET_PROGRAM(self, program);
+  return parse_json_reply(tea_terminal_query_secondary_device_attributes(program->handle, NUM2INT(timeout_ms)));
+}
+
+static VALUE program_query_terminal_version(VALUE self, VALUE timeout_ms) {
+  GET_PROGRAM(self, program);
+
+  char *version = tea_terminal_query_version(program->handle, NUM2INT(timeout_ms));
+
+  if (version == NULL || version[0] == '\0') {
+    tea_free(version);
+    return Qnil;
+  }
+
+  VALUE rb_version = rb_utf8_str_new_cstr(version);
+  tea_free(version);
+
+  return rb_version;
+}
+
+static VALUE color_reply(char *color) {
+  if (color == NULL || color[0] == '\0') {
+    tea_free(color);
+    return Qnil;
+  }
+
+  VALUE rb_color = rb_utf8_str_new_cstr(color);
+  tea_free(color);
+
+  return rb_color;
+}
+
+static VALUE program_query_background_color(VALUE self, VALUE timeout_ms) {
+  GET_PROGRAM(self, program);
+  return color_reply(tea_terminal_query_background_color(program->handle, NUM2INT(timeout_ms)));
+}
+
+static VALUE program_query_foreground_color(VALUE self, VALUE timeout_ms) {
+  GET_PROGRAM(self, program);
+  return color_reply(tea_terminal_query_foreground_color(program->handle, NUM2INT(timeout_ms)));
+}
+
+static VALUE program_has_dark_background(VALUE self, VALUE timeout_ms) {
+  GET_PROGRAM(self, program);
+
+  int dark = tea_terminal_has_dark_background(program->handle, NUM2INT(timeout_ms));
+
+  if (dark < 0) {
+    return Qnil;
+  }
+
+  return dark ? Qtrue : Qfalse;
+}
+
+/*
+ * query_mode(mode, timeout_ms, private: true) returns the DECRPM value for a
+ * DEC private mode, or for an ANSI mode with private: false. nil on timeout.
+ */
+static VALUE program_query_mode(int argc, VALUE *argv, VALUE self) {
+  GET_PROGRAM(self, program);
+
+  VALUE mode, timeout_ms, options;
+  rb_scan_args(argc, argv, "2:", &mode, &timeout_ms, &options);
+
+  int private = 1;
+
+  if (!NIL_P(options)) {
+    ID keys[1] = { rb_intern("private") };
+    VALUE values[1];
+
+    rb_get_kwargs(options, keys, 0, 1, values);
+
+    if (values[0] != Qundef) {
+      private = RTEST(values[0]);
+    }
+  }
+
+  int value = tea_terminal_query_mode(program->handle, NUM2INT(mode), private, NUM2INT(timeout_ms));
+
+  return value < 0 ? Qnil : INT2NUM(value);
+}
+
+static VALUE program_detect_capabilities(VALUE self, VALUE timeout_ms) {
+  GET_PROGRAM(self, program);
+  return parse_json_reply(tea_terminal_detect_capabilities(program->handle, NUM2INT(timeout_ms)));
+}
+
 /* Input methods */
 
 static VALUE program_start_input_reader(VALUE self) {
@@ -140,6 +507,12 @@ static VALUE program_stop_input_reader(VALUE self) {
   return Qnil;
 }
 
+static VALUE program_set_escape_timeout(VALUE self, VALUE timeout_ms) {
+  GET_PROGRAM(self, program);
+  tea_input_set_escape_timeout(program->handle, NUM2INT(timeout_ms));
+  return Qnil;
+}
+
 static VALUE program_read_raw_input(VALUE self, VALUE timeout_ms) {
   GET_PROGRAM(self, program);
 
@@ -182,11 +555,43 @@ static VALUE program_poll_event(VALUE self, VALUE timeout_ms) {
   return rb_hash;
 }
 
+static VALUE program_poll_events(VALUE self, VALUE timeout_ms) {
+  GET_PROGRAM(self, program);
+
+  char *json = tea_input_poll_events(program->handle, NUM2INT(timeout_ms));
+
+  if (json == NULL || json[0] == '\0') {
+    tea_free(json);
+    return rb_ary_new();
+  }
+
+  VALUE rb_json = rb_utf8_str_new_cstr(json);
+  tea_free(json);
+
+  VALUE rb_json_module = rb_const_get(rb_cObject, rb_intern("JSON"));
+
+  return rb_funcall(rb_json_module, rb_intern("parse"), 1, rb_json);
+}
+
 /* Renderer methods */
 
-static VALUE program_create_renderer(VALUE self) {
+static VALUE program_create_renderer(int argc, VALUE *argv, VALUE self) {
   GET_PROGRAM(self, program);
-  unsigned long long renderer_id = tea_renderer_new(program->handle);
+
+  VALUE mode;
+  rb_scan_args(argc, argv, "01", &mode);
+
+  int renderer_mode = 0;
+
+  if (!NIL_P(mode)) {
+    if (mode == ID2SYM(rb_intern("cells"))) {
+      renderer_mode = 1;
+    } else if (mode != ID2SYM(rb_intern("lines"))) {
+      rb_raise(rb_eArgError, "unknown renderer mode: %" PRIsVALUE, rb_inspect(mode));
+    }
+  }
+
+  unsigned long long renderer_id = tea_renderer_new(program->handle, renderer_mode);
   return ULL2NUM(renderer_id);
 }
 
@@ -196,6 +601,24 @@ static VALUE program_render(VALUE self, VALUE renderer_id, VALUE view) {
   return Qnil;
 }
 
+static VALUE program_render_layers(VALUE self, VALUE renderer_id, VALUE view, VALUE layers) {
+  Check_Type(view, T_STRING);
+  Check_Type(layers, T_ARRAY);
+
+  VALUE layers_json = rb_funcall(layers, rb_intern("to_json"), 0);
+
+  if (tea_renderer_render_layers(NUM2ULL(renderer_id), StringValueCStr(view), StringValueCStr(layers_json)) != 0) {
+    rb_raise(rb_eArgError, "invalid layers: %" PRIsVALUE, rb_inspect(layers));
+  }
+
+  return Qnil;
+}
+
+static VALUE program_renderer_scroll(VALUE self, VALUE renderer_id, VALUE top, VALUE bottom, VALUE lines) {
+  tea_renderer_scroll(NUM2ULL(renderer_id), NUM2INT(top), NUM2INT(bottom), NUM2INT(lines));
+  return Qnil;
+}
+
 static VALUE program_renderer_set_size(VALUE self, VALUE renderer_id, VALUE width, VALUE height) {
   tea_renderer_set_size(NUM2ULL(renderer_id), NUM2INT(width), NUM2INT(height));
   return Qnil;
@@ -211,6 +634,124 @@ static VALUE program_renderer_clear(VALUE self, VALUE renderer_id) {
   return Qnil;
 }
 
+static VALUE program_renderer_set_color_profile(VALUE self, VALUE renderer_id, VALUE profile) {
+  VALUE profile_string = NIL_P(profile) ? rb_str_new_cstr("") : rb_obj_as_string(profile);
+
+  if (tea_renderer_set_color_profile(NUM2ULL(renderer_id), StringValueCStr(profile_string)) != 0) {
+    rb_raise(rb_eArgError, "unknown color profile: %" PRIsVALUE, profile_string);
+  }
+
+  return Qnil;
+}
+
+static VALUE program_renderer_println(VALUE self, VALUE renderer_id, VALUE text) {
+  VALUE text_string = rb_obj_as_string(text);
+  tea_renderer_println(NUM2ULL(renderer_id), StringValueCStr(text_string));
+  return Qnil;
+}
+
+static VALUE program_renderer_printf(int argc, VALUE *argv, VALUE self) {
+  rb_check_arity(argc, 2, UNLIMITED_ARGUMENTS);
+
+  VALUE text = rb_f_sprintf(argc - 1, argv + 1);
+  tea_renderer_println(NUM2ULL(argv[0]), StringValueCStr(text));
+
+  return Qnil;
+}
+
+static VALUE program_renderer_set_cursor(int argc, VALUE *argv, VALUE self) {
+  VALUE renderer_id, x, y, shape, blink, color;
+  rb_scan_args(argc, argv, "33", &renderer_id, &x, &y, &shape, &blink, &color);
+
+  int cursor_shape = 0;
+
+  if (!NIL_P(shape)) {
+    if (shape == ID2SYM(rb_intern("underline"))) {
+      cursor_shape = 1;
+    } else if (shape == ID2SYM(rb_intern("bar"))) {
+      cursor_shape = 2;
+    } else if (shape != ID2SYM(rb_intern("block"))) {
+      rb_raise(rb_eArgError, "unknown cursor shape: %" PRIsVALUE, rb_inspect(shape));
+    }
+  }
+
+  int cursor_blink = NIL_P(blink) || RTEST(blink) ? 1 : 0;
+  VALUE color_string = NIL_P(color) ? rb_str_new_cstr("") : rb_obj_as_string(color);
+
+  tea_renderer_set_cursor(NUM2ULL(renderer_id), NUM2INT(x), NUM2INT(y), cursor_shape, cursor_blink, StringValueCStr(color_string));
+
+  return Qnil;
+}
+
+static VALUE program_renderer_hide_cursor(VALUE self, VALUE renderer_id) {
+  tea_renderer_hide_cursor(NUM2ULL(renderer_id));
+  return Qnil;
+}
+
+static VALUE program_renderer_set_output(VALUE self, VALUE renderer_id, VALUE target) {
+  int fd = output_target_fd(target);
+  int result = fd < 0 ? tea_renderer_set_output_buffer(NUM2ULL(renderer_id)) : tea_renderer_set_output_fd(NUM2ULL(renderer_id), fd);
+
+  if (result != 0) {
+    rb_raise(rb_eIOError, "could not use output %" PRIsVALUE, rb_inspect(target));
+  }
+
+  return Qnil;
+}
+
+static VALUE program_renderer_read_output(VALUE self, VALUE renderer_id) {
+  int length;
+  char *output = tea_renderer_read_output(NUM2ULL(renderer_id), &length);
+
+  return output_string(output, length);
+}
+
+static VALUE program_renderer_output_stats(VALUE self, VALUE renderer_id) {
+  return parse_json_reply(tea_renderer_output_stats(NUM2ULL(renderer_id)));
+}
+
+static VALUE program_renderer_start(VALUE self, VALUE renderer_id, VALUE fps) {
+  tea_renderer_start(NUM2ULL(renderer_id), NUM2INT(fps));
+  return Qnil;
+}
+
+static VALUE program_renderer_flush(VALUE self, VALUE renderer_id) {
+  tea_renderer_flush(NUM2ULL(renderer_id));
+  return Qnil;
+}
+
+static VALUE program_renderer_stop(VALUE self, VALUE renderer_id) {
+  tea_renderer_stop(NUM2ULL(renderer_id));
+  return Qnil;
+}
+
+static VALUE program_renderer_pause(VALUE self, VALUE renderer_id) {
+  tea_renderer_pause(NUM2ULL(renderer_id));
+  return Qnil;
+}
+
+static VALUE program_renderer_resume(VALUE self, VALUE renderer_id) {
+  tea_renderer_resume(NUM2ULL(renderer_id));
+  return Qnil;
+}
+
+static VALUE program_renderer_set_synchronized_output(VALUE self, VALUE renderer_id, VALUE enabled) {
+  tea_renderer_set_synchronized_output(NUM2ULL(renderer_id), RTEST(enabled) ? 1 : 0);
+  return Qnil;
+}
+
+static VALUE program_renderer_synchronized_output(VALUE self, VALUE renderer_id) {
+  return tea_renderer_get_synchronized_output(NUM2ULL(renderer_id)) ? Qtrue : Qfalse;
+}
+
+static VALUE program_renderer_color_profile(VALUE self, VALUE renderer_id) {
+  char *profile = tea_renderer_get_color_profile(NUM2ULL(renderer_id));
+  VALUE rb_profile = rb_utf8_str_new_cstr(profile);
+  tea_free(profile);
+
+  return rb_profile;
+}
+
 static VALUE program_string_width(VALUE self, VALUE str) {
   Check_Type(str, T_STRING);
   return INT2NUM(tea_string_width(StringValueCStr(str)));
@@ -220,8 +761,21 @@ void Init_bubbletea_program(void) {
   cProgram = rb_define_class_under(mBubbletea, "Program", rb_cObject);
 
   rb_define_alloc_func(cProgram, program_alloc);
-  rb_define_method(cProgram, "initialize", program_initialize, 0);
-
+  rb_define_method(cProgram, "initialize", program_initialize, -1);
+
+  rb_define_method(cProgram, "set_output", program_set_output, 1);
+  rb_define_method(cProgram, "set_input", program_set_input, 1);
+  rb_define_method(cProgram, "open_tty", program_open_tty, 1);
+  rb_define_method(cProgram, "read_output", program_read_output, 0);
+  rb_define_method(cProgram, "output_stats", program_output_stats, 0);
+  rb_define_method(cProgram, "attach_emulator", program_attach_emulator, 1);
+  rb_define_method(cProgram, "redirected_streams", program_redirected_streams, 0);
+
+  rb_define_method(cProgram, "tty?", program_tty, 0);
+  rb_define_method(cProgram, "output_tty?", program_output_tty, 0);
+  rb_define_method(cProgram, "write", program_write, 1);
+  rb_define_method(cProgram, "set_window_title", program_set_window_title, 1);
+  rb_define_method(cProgram, "clear_screen", program_clear_screen, 0);
   rb_define_method(cProgram, "enter_raw_mode", program_enter_raw_mode, 0);
   rb_define_method(cProgram, "exit_raw_mode", program_exit_raw_mode, 0);
   rb_define_method(cProgram, "enter_alt_screen", program_enter_alt_screen, 0);
@@ -235,17 +789,56 @@ void Init_bubbletea_program(void) {
   rb_define_method(cProgram, "disable_bracketed_paste", program_disable_bracketed_paste, 0);
   rb_define_method(cProgram, "enable_report_focus", program_enable_report_focus, 0);
   rb_define_method(cProgram, "disable_report_focus", program_disable_report_focus, 0);
+  rb_define_method(cProgram, "enable_in_band_resize", program_enable_in_band_resize, 0);
+  rb_define_method(cProgram, "disable_in_band_resize", program_disable_in_band_resize, 0);
+  rb_define_method(cProgram, "push_kitty_keyboard", program_push_kitty_keyboard, 1);
+  rb_define_method(cProgram, "pop_kitty_keyboard", program_pop_kitty_keyboard, 0);
+  rb_define_method(cProgram, "enable_application_cursor", program_enable_application_cursor, 0);
+  rb_define_method(cProgram, "disable_application_cursor", program_disable_application_cursor, 0);
+  rb_define_method(cProgram, "enable_application_keypad", program_enable_application_keypad, 0);
+  rb_define_method(cProgram, "disable_application_keypad", program_disable_application_keypad, 0);
   rb_define_method(cProgram, "terminal_size", program_terminal_size, 0);
+  rb_define_method(cProgram, "window_size", program_window_size, 0);
+
+  rb_define_method(cProgram, "query_cursor_position", program_query_cursor_position, 1);
+  rb_define_method(cProgram, "query_device_attributes", program_query_device_attributes, 1);
+  rb_define_method(cProgram, "query_secondary_device_attributes", program_query_secondary_device_attributes, 1);
+  rb_define_method(cProgram, "query_terminal_version", program_query_terminal_version, 1);
+  rb_define_method(cProgram, "query_mode", program_query_mode, -1);
+  rb_define_method(cProgram, "query_background_color", program_query_background_color, 1);
+  rb_define_method(cProgram, "query_foreground_color", program_query_foreground_color, 1);
+  rb_define_method(cProgram, "has_dark_background?", program_has_dark_background, 1);
+  rb_define_method(cProgram, "detect_capabilities", program_detect_capabilities, 1);
 
   rb_define_method(cProgram, "start_input_reader", program_start_input_reader, 0);
   rb_define_method(cProgram, "stop_input_reader", program_stop_input_reader, 0);
+  rb_define_method(cProgram, "set_escape_timeout", program_set_escape_timeout, 1);
   rb_define_method(cProgram, "read_raw_input", program_read_raw_input, 1);
   rb_define_method(cProgram, "poll_event", program_poll_event, 1);
+  rb_define_method(cProgram, "poll_events", program_poll_events, 1);
 
-  rb_define_method(cProgram, "create_renderer", program_create_renderer, 0);
+  rb_define_method(cProgram, "create_renderer", program_create_renderer, -1);
   rb_define_method(cProgram, "render", program_render, 2);
+  rb_define_method(cProgram, "render_layers", program_render_layers, 3);
+  rb_define_method(cProgram, "renderer_scroll", program_renderer_scroll, 4);
   rb_define_method(cProgram, "renderer_set_size", program_renderer_set_size, 3);
   rb_define_method(cProgram, "renderer_set_alt_screen", program_renderer_set_alt_screen, 2);
   rb_define_method(cProgram, "renderer_clear", program_renderer_clear, 1);
+  rb_define_method(cProgram, "renderer_set_color_profile", program_renderer_set_color_profile, 2);
+  rb_define_method(cProgram, "renderer_color_profile", program_renderer_color_profile, 1);
+  rb_define_method(cProgram, "renderer_println", program_renderer_println, 2);
+  rb_define_method(cProgram, "renderer_printf", program_renderer_printf, -1);
+  rb_define_method(cProgram, "renderer_set_cursor", program_renderer_set_cursor, -1);
+  rb_define_method(cProgram, "renderer_hide_cursor", program_renderer_hide_cursor, 1);
+  rb_define_method(cProgram, "renderer_set_output", program_renderer_set_output, 2);
+  rb_define_method(cProgram, "renderer_read_output", program_renderer_read_output, 1);
+  rb_define_method(cProgram, "renderer_output_stats", program_renderer_output_stats, 1);
+  rb_define_method(cProgram, "renderer_start", program_renderer_start, 2);
+  rb_define_method(cProgram, "renderer_flush", program_renderer_flush, 1);
+  rb_define_method(cProgram, "renderer_stop", program_renderer_stop, 1);
+  rb_define_method(cProgram, "renderer_pause", program_renderer_pause, 1);
+  rb_define_method(cProgram, "renderer_resume", program_renderer_resume, 1);
+  rb_define_method(cProgram, "renderer_set_synchronized_output", program_renderer_set_synchronized_output, 2);
+  rb_define_method(cProgram, "renderer_synchronized_output?", program_renderer_synchronized_output, 1);
   rb_define_method(cProgram, "string_width", program_string_width, 1);
 }
@@ -6,8 +6,11 @@ package main
 import "C"
 
 import (
+	"io"
+	"os"
 	"runtime/debug"
 	"sync"
+	"time"
 	"unsafe"
 )
 
@@ -30,10 +33,19 @@ var (
 )
 
 type ProgramState struct {
-	terminal *Terminal
-	input    *InputReader
-	width    int
-	height   int
+	terminal      *Terminal
+	input         *InputReader
+	sizeMu        sync.Mutex
+	width         int
+	height        int
+	pixelWidth    int
+	pixelHeight   int
+	escapeTimeout time.Duration
+	output        io.Writer
+	writer        *OutputWriter
+	inputFile     *os.File
+	inputOwned    bool
+	redirected    int
 }
 
 func getProgram(id uint64) *ProgramState {
@@ -49,7 +61,10 @@ func tea_free(pointer *C.char) {
 
 //export tea_new_program
 func tea_new_program() C.ulonglong {
-	state := &ProgramState{}
+	state := &ProgramState{
+		escapeTimeout: DefaultEscapeTimeout,
+		writer:        NewOutputWriter(os.Stdout),
+	}
 
 	programsMu.Lock()
 	id := getNextID()
@@ -73,6 +88,14 @@ func tea_free_program(id C.ulonglong) {
 		if state.terminal != nil {
 			state.terminal.Restore()
 		}
+
+		if state.output != nil {
+			closeOutput(state.output)
+		}
+
+		if state.inputOwned {
+			state.inputFile.Close()
+		}
 	}
 
 	delete(programs, uint64(id))
@@ -0,0 +1,225 @@
+package main
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/charmbracelet/x/term"
+)
+
+// Color profiles, from most to least capable.
+const (
+	ColorProfileTrueColor = "truecolor"
+	ColorProfileANSI256   = "ansi256"
+	ColorProfileANSI      = "ansi"
+	ColorProfileAscii     = "ascii"
+	ColorProfileNoTTY     = "notty"
+)
+
+// Capabilities describes what the terminal a program runs in supports,
+// combining the environment with the terminal's replies to queries.
+type Capabilities struct {
+	Probed             bool     `json:"probed"`              // Terminal answered the queries
+	ColorProfile       string   `json:"color_profile"`       // See ColorProfile constants
+	SynchronizedOutput bool     `json:"synchronized_output"` // Mode 2026
+	GraphemeClustering bool     `json:"grapheme_clustering"` // Mode 2027
+	BracketedPaste     bool     `json:"bracketed_paste"`     // Mode 2004
+	KittyKeyboard      bool     `json:"kitty_keyboard"`      // Kitty keyboard protocol
+	Graphics           []string `json:"graphics"`            // "kitty", "sixel" and/or "iterm2"
+	Hyperlinks         bool     `json:"hyperlinks"`          // OSC 8
+	TerminalName       string   `json:"terminal_name"`
+	TerminalVersion    string   `json:"terminal_version"`
+	DeviceAttributes   []int    `json:"device_attributes"` // DA1 attributes
+	BackgroundColor    string   `json:"background_color"`  // OSC 11 reply, e.g. "#1e1e2e"
+	DarkBackground     bool     `json:"dark_background"`   // Assumed when the terminal doesn't say
+}
+
+// Terminals known to support truecolor and hyperlinks, and the subset that
+// implements the kitty graphics protocol, by lowercase XTVERSION or
+// TERM_PROGRAM name.
+var (
+	modernTerminals        = []string{"kitty", "wezterm", "ghostty", "foot", "iterm2", "iterm.app", "alacritty", "contour", "vscode", "rio", "konsole", "windows terminal"}
+	kittyGraphicsTerminals = []string{"kitty", "wezterm", "ghostty", "konsole"}
+)
+
+// trueColorTermPrefixes are TERM values of terminals that always support truecolor.
+var trueColorTermPrefixes = []string{"xterm-kitty", "alacritty", "wezterm", "xterm-ghostty", "foot"}
+
+// capabilityProbe asks for the modes we care about, the kitty keyboard flags,
+// XTVERSION and the background color, with DA1 last so its reply marks the
+// end of the answers.
+var capabilityProbe = ansi.RequestSynchronizedOutputMode +
+	ansi.RequestGraphemeClusteringMode +
+	ansi.RequestMode(ansi.BracketedPasteMode) +
+	ansi.RequestKittyKeyboard +
+	ansi.RequestNameVersion +
+	ansi.RequestBackgroundColor +
+	ansi.RequestPrimaryDeviceAttributes
+
+// DetectCapabilities builds a capability report from the environment and,
+// when an input reader is available, from the terminal's replies to a probe.
+func DetectCapabilities(input *InputReader, output io.Writer, timeout time.Duration) *Capabilities {
+	capabilities := &Capabilities{
+		Graphics:         []string{},
+		DeviceAttributes: []int{},
+		TerminalName:     os.Getenv("TERM_PROGRAM"),
+		TerminalVersion:  os.Getenv("TERM_PROGRAM_VERSION"),
+		DarkBackground:   true,
+	}
+
+	if input != nil {
+		replies, complete := input.QueryUntil(capabilityProbe, timeout, "primary_device_attributes")
+		capabilities.Probed = complete
+
+		for _, reply := range replies {
+			capabilities.applyReply(reply)
+		}
+	}
+
+	name := strings.ToLower(capabilities.TerminalName)
+
+	if os.Getenv("WT_SESSION") != "" && name == "" {
+		name = "windows terminal"
+	}
+
+	capabilities.ColorProfile = detectColorProfile(name, output)
+
+	if slices.Contains(modernTerminals, name) || vteVersion() >= 5000 {
+		capabilities.Hyperlinks = true
+	}
+
+	if slices.Contains(kittyGraphicsTerminals, name) {
+		capabilities.Graphics = append(capabilities.Graphics, "kitty")
+	}
+
+	if slices.Contains(capabilities.DeviceAttributes, 4) {
+		capabilities.Graphics = append(capabilities.Graphics, "sixel")
+	}
+
+	if name == "iterm2" || name == "iterm.app" || name == "wezterm" {
+		capabilities.Graphics = append(capabilities.Graphics, "iterm2")
+	}
+
+	return capabilities
+}
+
+func (capabilities *Capabilities) applyReply(reply string) {
+	switch eventType(reply) {
+	case "mode_report":
+		var event ModeReportEvent
+		json.Unmarshal([]byte(reply), &event)
+
+		// Recognized modes report set, reset or permanently set
+		supported := event.Value >= 1 && event.Value <= 3
+
+		switch event.Mode {
+		case ansi.SynchronizedOutputMode.Mode():
+			capabilities.SynchronizedOutput = supported
+		case ansi.GraphemeClusteringMode.Mode():
+			capabilities.GraphemeClustering = supported
+		case ansi.BracketedPasteMode.Mode():
+			capabilities.BracketedPaste = supported
+		}
+
+	case "kitty_keyboard":
+		capabilities.KittyKeyboard = true
+
+	case "terminal_version":
+		var event TerminalVersionEvent
+		json.Unmarshal([]byte(reply), &event)
+
+		capabilities.TerminalName, capabilities.TerminalVersion = splitTerminalVersion(event.Version)
+
+	case "background_color":
+		var event ColorEvent
+		json.Unmarshal([]byte(reply), &event)
+
+		capabilities.BackgroundColor = event.Color
+		capabilities.DarkBackground = event.Dark
+
+	case "primary_device_attributes":
+		var event DeviceAttributesEvent
+		json.Unmarshal([]byte(reply), &event)
+
+		capabilities.DeviceAttributes = event.Attributes
+	}
+}
+
+// splitTerminalVersion splits an XTVERSION reply such as "kitty(0.31.0)",
+// "XTerm(388)" or "WezTerm 20230712" into name and version.
+func splitTerminalVersion(version string) (string, string) {
+	if name, rest, ok := strings.Cut(version, "("); ok {
+		return name, strings.TrimSuffix(rest, ")")
+	}
+
+	name, rest, _ := strings.Cut(version, " ")
+
+	return name, rest
+}
+
+// detectColorProfile picks the color profile for output, which only gets
+// escape sequences when it is a terminal or an emulator.
+func detectColorProfile(terminalName string, output io.Writer) string {
+	if emulated, ok := output.(interface{ ColorProfile() string }); ok {
+		return emulated.ColorProfile()
+	}
+
+	if file, ok := output.(*os.File); !ok || !term.IsTerminal(file.Fd()) {
+		return ColorProfileNoTTY
+	}
+
+	if os.Getenv("NO_COLOR") != "" {
+		return ColorProfileAscii
+	}
+
+	termEnv := strings.ToLower(os.Getenv("TERM"))
+	colorTerm := strings.ToLower(os.Getenv("COLORTERM"))
+
+	switch {
+	case termEnv == "dumb":
+		return ColorProfileAscii
+	case colorTerm == "truecolor" || colorTerm == "24bit":
+		return ColorProfileTrueColor
+	case strings.HasSuffix(termEnv, "-direct") || slices.Contains(modernTerminals, terminalName):
+		return ColorProfileTrueColor
+	case slices.ContainsFunc(trueColorTermPrefixes, func(prefix string) bool { return strings.HasPrefix(termEnv, prefix) }):
+		return ColorProfileTrueColor
+	case strings.Contains(termEnv, "256color"):
+		return ColorProfileANSI256
+	}
+
+	return ColorProfileANSI
+}
+
+// vteVersion returns VTE_VERSION (e.g. 6003 for 0.60.3), or 0 when unset.
+func vteVersion() int {
+	version, _ := strconv.Atoi(os.Getenv("VTE_VERSION"))
+	return version
+}
+
+//export tea_terminal_detect_capabilities
+func tea_terminal_detect_capabilities(programID C.ulonglong, timeoutMs C.int) *C.char {
+	state := getProgram(uint64(programID))
+
+	if state == nil || state.terminal == nil {
+		return C.CString("")
+	}
+
+	if state.terminal.capabilities == nil {
+		state.terminal.capabilities = DetectCapabilities(state.input, state.Output(), time.Duration(timeoutMs)*time.Millisecond)
+	}
+
+	jsonBytes, _ := json.Marshal(state.terminal.capabilities)
+
+	return C.CString(string(jsonBytes))
+}
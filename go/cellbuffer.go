@@ -0,0 +1,512 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// Renderer modes, selected when the renderer is created.
+const (
+	RendererModeLines = 0 // Redraw changed lines
+	RendererModeCells = 1 // Redraw changed cells
+)
+
+// tabWidth is the distance between the terminal's default tab stops.
+const tabWidth = 8
+
+// Cell is one terminal cell of a frame. Wide graphemes occupy their own cell
+// followed by continuation cells with zero width and no content.
+type Cell struct {
+	Content string    `json:"content"`
+	Width   int       `json:"width"`
+	Style   CellStyle `json:"style"`
+}
+
+// CellStyle is the SGR state a cell was written with. Colors hold the SGR
+// parameters that select them (e.g. "31" or "38;5;196"), empty for default.
+type CellStyle struct {
+	Bold           bool   `json:"bold,omitempty"`
+	Faint          bool   `json:"faint,omitempty"`
+	Italic         bool   `json:"italic,omitempty"`
+	Blink          bool   `json:"blink,omitempty"`
+	Reverse        bool   `json:"reverse,omitempty"`
+	Conceal        bool   `json:"conceal,omitempty"`
+	Strike         bool   `json:"strike,omitempty"`
+	Overline       bool   `json:"overline,omitempty"`
+	Underline      string `json:"underline,omitempty"` // "4", "21" or "4:n" for styled underlines
+	Foreground     string `json:"foreground,omitempty"`
+	Background     string `json:"background,omitempty"`
+	UnderlineColor string `json:"underline_color,omitempty"`
+}
+
+var blankCell = Cell{Content: " ", Width: 1}
+
+// Sequence returns the SGR sequence that sets the style from scratch.
+func (style CellStyle) Sequence() string {
+	params := []string{"0"}
+
+	flags := []struct {
+		set   bool
+		param string
+	}{
+		{style.Bold, "1"}, {style.Faint, "2"}, {style.Italic, "3"}, {style.Blink, "5"},
+		{style.Reverse, "7"}, {style.Conceal, "8"}, {style.Strike, "9"}, {style.Overline, "53"},
+	}
+
+	for _, flag := range flags {
+		if flag.set {
+			params = append(params, flag.param)
+		}
+	}
+
+	for _, param := range []string{style.Underline, style.Foreground, style.Background, style.UnderlineColor} {
+		if param != "" {
+			params = append(params, param)
+		}
+	}
+
+	if len(params) == 1 {
+		return ansi.ResetStyle
+	}
+
+	return "\x1b[" + strings.Join(params, ";") + "m"
+}
+
+// apply updates the style with the parameters of an SGR sequence.
+func (style *CellStyle) apply(params string) {
+	if params == "" {
+		*style = CellStyle{}
+		return
+	}
+
+	tokens := strings.Split(params, ";")
+
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+
+		if code, _, ok := strings.Cut(token, ":"); ok {
+			switch code {
+			case "4":
+				style.Underline = token
+
+				if token == "4:0" {
+					style.Underline = ""
+				}
+			case "38":
+				style.Foreground = token
+			case "48":
+				style.Background = token
+			case "58":
+				style.UnderlineColor = token
+			}
+
+			continue
+		}
+
+		code, err := strconv.Atoi(token)
+
+		if err != nil && token != "" {
+			continue
+		}
+
+		switch {
+		case code == 0:
+			*style = CellStyle{}
+		case code == 1:
+			style.Bold = true
+		case code == 2:
+			style.Faint = true
+		case code == 3:
+			style.Italic = true
+		case code == 4 || code == 21:
+			style.Underline = token
+		case code == 5 || code == 6:
+			style.Blink = true
+		case code == 7:
+			style.Reverse = true
+		case code == 8:
+			style.Conceal = true
+		case code == 9:
+			style.Strike = true
+		case code == 22:
+			style.Bold, style.Faint = false, false
+		case code == 23:
+			style.Italic = false
+		case code == 24:
+			style.Underline = ""
+		case code == 25:
+			style.Blink = false
+		case code == 27:
+			style.Reverse = false
+		case code == 28:
+			style.Conceal = false
+		case code == 29:
+			style.Strike = false
+		case code == 53:
+			style.Overline = true
+		case code == 55:
+			style.Overline = false
+		case code >= 30 && code <= 37, code >= 90 && code <= 97:
+			style.Foreground = token
+		case code == 39:
+			style.Foreground = ""
+		case code >= 40 && code <= 47, code >= 100 && code <= 107:
+			style.Background = token
+		case code == 49:
+			style.Background = ""
+		case code == 59:
+			style.UnderlineColor = ""
+		case code == 38 || code == 48 || code == 58:
+			_, consumed, ok := parseSGRColorTokens(tokens[i:])
+
+			if !ok {
+				return
+			}
+
+			color := strings.Join(tokens[i:i+consumed], ";")
+
+			switch code {
+			case 38:
+				style.Foreground = color
+			case 48:
+				style.Background = color
+			case 58:
+				style.UnderlineColor = color
+			}
+
+			i += consumed - 1
+		}
+	}
+}
+
+// parseCells splits rendered lines into rows of cells, padded with blanks to
+// width when it is known. Escape sequences other than SGR are dropped.
+func parseCells(lines []string, width int) [][]Cell {
+	rows := make([][]Cell, len(lines))
+
+	for y, line := range lines {
+		var (
+			row   []Cell
+			style CellStyle
+			state byte
+		)
+
+		for len(line) > 0 {
+			sequence, cellWidth, n, newState := ansi.DecodeSequence(line, state, nil)
+			state = newState
+			line = line[n:]
+
+			switch {
+			case cellWidth > 0:
+				if width > 0 && len(row)+cellWidth > width {
+					line = ""
+					break
+				}
+
+				row = append(row, Cell{Content: sequence, Width: cellWidth, Style: style})
+
+				for i := 1; i < cellWidth; i++ {
+					row = append(row, Cell{Style: style})
+				}
+
+			case sequence == "\t":
+				for next := (len(row)/tabWidth + 1) * tabWidth; len(row) < next && (width == 0 || len(row) < width); {
+					row = append(row, Cell{Content: " ", Width: 1, Style: style})
+				}
+
+			case strings.HasPrefix(sequence, "\x1b[") && strings.HasSuffix(sequence, "m"):
+				style.apply(sequence[2 : len(sequence)-1])
+			}
+		}
+
+		for len(row) < width {
+			row = append(row, blankCell)
+		}
+
+		rows[y] = row
+	}
+
+	return rows
+}
+
+// supportsRepeat reports whether the terminal is expected to implement REP.
+// Terminals without it would silently drop the repeated characters.
+func supportsRepeat() bool {
+	termEnv := os.Getenv("TERM")
+
+	return os.Getenv("TERM_PROGRAM") != "Apple_Terminal" && termEnv != "linux" && !strings.HasPrefix(termEnv, "screen")
+}
+
+// cellWriter accumulates the output of a cell diff and tracks where the
+// cursor and the pen are.
+type cellWriter struct {
+	renderer *Renderer
+	buffer   strings.Builder
+	x, y     int // Cursor position; x is -1 after writing the last column
+	rows     int // Rows on screen that relative moves can reach
+	pen      CellStyle
+}
+
+// moveTo puts the cursor at column x of row y using the shortest sequence.
+func (writer *cellWriter) moveTo(x, y int) {
+	if writer.x == x && writer.y == y {
+		return
+	}
+
+	renderer := writer.renderer
+
+	if renderer.altScreen && writer.y < 0 {
+		writer.buffer.WriteString(ansi.CursorPosition(x+1, y+1))
+		writer.x, writer.y = x, y
+		return
+	}
+
+	var vertical string
+
+	switch {
+	case y < writer.y:
+		vertical = ansi.CursorUp(writer.y - y)
+	case y > writer.y:
+		existing := max(min(y, writer.rows-1)-writer.y, 0)
+
+		if existing > 0 {
+			vertical = ansi.CursorDown(existing)
+		}
+
+		if writer.y+existing < y {
+			// Inline frames grow by scrolling; newlines also return the carriage
+			vertical += strings.Repeat("\r\n", y-writer.y-existing)
+			writer.x = 0
+		}
+	}
+
+	horizontal := writer.horizontalMove(x)
+	move := vertical + horizontal
+
+	if renderer.altScreen {
+		if absolute := ansi.CursorPosition(x+1, y+1); len(absolute) < len(move) {
+			move = absolute
+		}
+	}
+
+	writer.buffer.WriteString(move)
+	writer.x, writer.y = x, y
+	writer.rows = max(writer.rows, y+1)
+}
+
+func (writer *cellWriter) horizontalMove(x int) string {
+	if writer.x == x {
+		return ""
+	}
+
+	if x == 0 {
+		return "\r"
+	}
+
+	best := ansi.CursorHorizontalAbsolute(x + 1)
+
+	candidates := []string{"\r" + ansi.CursorForward(x)}
+
+	if writer.x >= 0 && x > writer.x {
+		candidates = append(candidates, ansi.CursorForward(x-writer.x))
+	}
+
+	if writer.x > x {
+		candidates = append(candidates, ansi.CursorBackward(writer.x-x))
+	}
+
+	for _, candidate := range candidates {
+		if len(candidate) < len(best) {
+			best = candidate
+		}
+	}
+
+	return best
+}
+
+func (writer *cellWriter) setPen(style CellStyle) {
+	if writer.pen == style {
+		return
+	}
+
+	writer.buffer.WriteString(style.Sequence())
+	writer.pen = style
+}
+
+// writeCell prints cell at the cursor and advances it.
+func (writer *cellWriter) writeCell(cell Cell) {
+	writer.setPen(cell.Style)
+	writer.buffer.WriteString(cell.Content)
+	writer.advance(cell.Width)
+}
+
+func (writer *cellWriter) advance(width int) {
+	writer.x += width
+
+	if writer.renderer.width > 0 && writer.x >= writer.renderer.width {
+		// The cursor waits in the last column until the next character
+		writer.x = -1
+	}
+}
+
+func cellAt(row []Cell, x int) Cell {
+	if x < len(row) {
+		return row[x]
+	}
+
+	return blankCell
+}
+
+// contentWidth returns the number of cells up to the last one that isn't a
+// default-styled blank.
+func contentWidth(row []Cell) int {
+	for x := len(row) - 1; x >= 0; x-- {
+		if row[x] != blankCell {
+			return x + 1
+		}
+	}
+
+	return 0
+}
+
+// diffCells returns the output that turns the previous frame into lines,
+// touching only the cells that changed. Like diffLines, the cursor starts
+// and ends at the beginning of the frame's last line in inline mode.
+func (renderer *Renderer) diffCells(lines []string) string {
+	rows := parseCells(lines, renderer.width)
+	previous := renderer.lastCells
+
+	writer := &cellWriter{renderer: renderer, y: max(renderer.linesRendered-1, 0), rows: renderer.linesRendered}
+
+	if renderer.altScreen {
+		// The cursor position is unknown to us, so start with an absolute move
+		writer.x, writer.y = -1, -1
+	}
+
+	for y, row := range rows {
+		if y < len(previous) {
+			renderer.diffRow(writer, y, previous[y], row, true)
+		} else {
+			renderer.diffRow(writer, y, nil, row, false)
+		}
+	}
+
+	for y := len(rows); y < renderer.linesRendered; y++ {
+		writer.moveTo(0, y)
+		writer.setPen(CellStyle{})
+		writer.buffer.WriteString(ansi.EraseLine(2))
+	}
+
+	writer.setPen(CellStyle{})
+
+	if !renderer.altScreen && writer.buffer.Len() > 0 {
+		writer.moveTo(0, len(rows)-1)
+	}
+
+	renderer.lastCells = rows
+
+	return writer.buffer.String()
+}
+
+// diffRow writes the cells of row y that differ from old. When known is
+// false, the row's previous screen contents are unknown and it is redrawn.
+func (renderer *Renderer) diffRow(writer *cellWriter, y int, old, row []Cell, known bool) {
+	end := contentWidth(row)
+	oldEnd := len(old)
+
+	if known {
+		oldEnd = contentWidth(old)
+	}
+
+	for x := 0; x < end; {
+		cell := row[x]
+
+		if known && cellAt(old, x) == cell {
+			x++
+			continue
+		}
+
+		// A changed continuation cell means its wide grapheme must be rewritten
+		for x > 0 && row[x].Width == 0 {
+			x--
+		}
+
+		cell = row[x]
+		writer.moveTo(x, y)
+
+		if cell.Width == 0 {
+			// Orphaned continuation of a truncated wide grapheme
+			writer.writeCell(blankCell)
+			x++
+			continue
+		}
+
+		if run := renderer.blankRun(row, x, end); run > 0 {
+			writer.setPen(CellStyle{})
+			writer.buffer.WriteString(ansi.EraseCharacter(run))
+			x += run
+			continue
+		}
+
+		if run := renderer.repeatRun(row, x, end); run > 0 {
+			writer.writeCell(cell)
+			writer.buffer.WriteString(ansi.RepeatPreviousCharacter(run))
+			writer.advance(run)
+			x += run + 1
+			continue
+		}
+
+		writer.writeCell(cell)
+		x += max(cell.Width, 1)
+	}
+
+	// A full row leaves nothing to erase, and the cursor can't move past the
+	// last column, so an erase there would take the last character with it
+	if (!known || oldEnd > end) && (renderer.width <= 0 || end < renderer.width) {
+		writer.moveTo(end, y)
+		writer.setPen(CellStyle{})
+		writer.buffer.WriteString(ansi.EraseLine(0))
+	}
+}
+
+// blankRun returns the length of the run of default blanks at x when erasing
+// it with ECH and stepping over it is cheaper than printing spaces, else 0.
+func (renderer *Renderer) blankRun(row []Cell, x, end int) int {
+	run := 0
+
+	for x+run < end && row[x+run] == blankCell {
+		run++
+	}
+
+	cost := len(ansi.EraseCharacter(run)) + len(ansi.CursorForward(run))
+
+	if run <= cost {
+		return 0
+	}
+
+	return run
+}
+
+// repeatRun returns how many copies of the single-width ASCII cell at x
+// follow it when emitting them with REP is cheaper than printing them, else 0.
+func (renderer *Renderer) repeatRun(row []Cell, x, end int) int {
+	cell := row[x]
+
+	if !renderer.repeatChars || cell.Width != 1 || len(cell.Content) != 1 {
+		return 0
+	}
+
+	run := 0
+
+	for x+run+1 < end && row[x+run+1] == cell {
+		run++
+	}
+
+	if run <= len(ansi.RepeatPreviousCharacter(run)) {
+		return 0
+	}
+
+	return run
+}
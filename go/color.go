@@ -0,0 +1,345 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+// ansiPalette holds the xterm default RGB values of the 16 basic colors.
+var ansiPalette = [16]colorful.Color{
+	rgb(0x00, 0x00, 0x00), rgb(0x80, 0x00, 0x00), rgb(0x00, 0x80, 0x00), rgb(0x80, 0x80, 0x00),
+	rgb(0x00, 0x00, 0x80), rgb(0x80, 0x00, 0x80), rgb(0x00, 0x80, 0x80), rgb(0xc0, 0xc0, 0xc0),
+	rgb(0x80, 0x80, 0x80), rgb(0xff, 0x00, 0x00), rgb(0x00, 0xff, 0x00), rgb(0xff, 0xff, 0x00),
+	rgb(0x00, 0x00, 0xff), rgb(0xff, 0x00, 0xff), rgb(0x00, 0xff, 0xff), rgb(0xff, 0xff, 0xff),
+}
+
+// cubeLevels are the channel values of the 6x6x6 color cube (indices 16-231).
+var cubeLevels = [6]int{0x00, 0x5f, 0x87, 0xaf, 0xd7, 0xff}
+
+// sgrColor is a color parameter of an SGR sequence, before conversion.
+type sgrColor struct {
+	target int // 38 foreground, 48 background, 58 underline
+	index  int // Palette index, or -1 for an RGB color
+	color  colorful.Color
+}
+
+func rgb(r, g, b int) colorful.Color {
+	return colorful.Color{R: float64(r) / 255, G: float64(g) / 255, B: float64(b) / 255}
+}
+
+func isColorProfile(profile string) bool {
+	switch profile {
+	case ColorProfileTrueColor, ColorProfileANSI256, ColorProfileANSI, ColorProfileAscii, ColorProfileNoTTY:
+		return true
+	}
+
+	return false
+}
+
+// ConvertColors rewrites the SGR sequences in s for the given color profile:
+// colors are downsampled to the nearest supported one, dropped for Ascii,
+// and every escape sequence is stripped for NoTTY.
+func ConvertColors(s string, profile string) string {
+	switch profile {
+	case ColorProfileTrueColor:
+		return s
+	case ColorProfileNoTTY:
+		return ansi.Strip(s)
+	}
+
+	if !strings.Contains(s, "\x1b[") {
+		return s
+	}
+
+	var buffer strings.Builder
+	buffer.Grow(len(s))
+
+	for {
+		start := strings.Index(s, "\x1b[")
+
+		if start < 0 {
+			buffer.WriteString(s)
+			break
+		}
+
+		buffer.WriteString(s[:start])
+		s = s[start:]
+
+		end := 2
+		for end < len(s) && (s[end] < 0x40 || s[end] > 0x7e) {
+			end++
+		}
+
+		if end == len(s) {
+			buffer.WriteString(s)
+			break
+		}
+
+		if s[end] == 'm' {
+			buffer.WriteString(convertSGR(s[2:end], profile))
+		} else {
+			buffer.WriteString(s[:end+1])
+		}
+
+		s = s[end+1:]
+	}
+
+	return buffer.String()
+}
+
+// convertSGR returns the SGR sequence for params rewritten for profile. An
+// empty string is returned when every parameter was dropped, since an empty
+// SGR would reset all attributes.
+func convertSGR(params string, profile string) string {
+	if params == "" || strings.IndexFunc(params, func(r rune) bool { return (r < '0' || r > '9') && r != ';' && r != ':' }) >= 0 {
+		return "\x1b[" + params + "m"
+	}
+
+	tokens := strings.Split(params, ";")
+	output := make([]string, 0, len(tokens))
+
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+
+		if strings.Contains(token, ":") {
+			// Colon form, e.g. "38:2::255:0:0" or "58:5:196"
+			subParams := strings.Split(token, ":")
+			color, ok := parseSGRColor(subParams, true)
+
+			if !ok {
+				output = append(output, token)
+				continue
+			}
+
+			output = append(output, formatSGRColor(color, profile, ":")...)
+			continue
+		}
+
+		code, err := strconv.Atoi(token)
+
+		if err != nil {
+			output = append(output, token)
+			continue
+		}
+
+		switch {
+		case code == 38 || code == 48 || code == 58:
+			color, consumed, ok := parseSGRColorTokens(tokens[i:])
+
+			if !ok {
+				// Malformed extended color: keep the rest as-is rather than guess
+				output = append(output, tokens[i:]...)
+				i = len(tokens)
+				continue
+			}
+
+			output = append(output, formatSGRColor(color, profile, ";")...)
+			i += consumed - 1
+
+		case isBasicColorCode(code):
+			if profile != ColorProfileAscii {
+				output = append(output, token)
+			}
+
+		default:
+			output = append(output, token)
+		}
+	}
+
+	if len(output) == 0 {
+		return ""
+	}
+
+	return "\x1b[" + strings.Join(output, ";") + "m"
+}
+
+// isBasicColorCode reports whether code selects a basic foreground or
+// background color, or resets a color to its default.
+func isBasicColorCode(code int) bool {
+	switch {
+	case code >= 30 && code <= 37, code >= 40 && code <= 47:
+		return true
+	case code >= 90 && code <= 97, code >= 100 && code <= 107:
+		return true
+	}
+
+	return code == 39 || code == 49 || code == 59
+}
+
+// parseSGRColorTokens parses a semicolon separated extended color starting at
+// tokens[0] (38, 48 or 58) and returns how many tokens it spans.
+func parseSGRColorTokens(tokens []string) (sgrColor, int, bool) {
+	if len(tokens) < 3 {
+		return sgrColor{}, 0, false
+	}
+
+	switch tokens[1] {
+	case "5":
+		color, ok := parseSGRColor(tokens[:3], false)
+		return color, 3, ok
+	case "2":
+		if len(tokens) < 5 {
+			return sgrColor{}, 0, false
+		}
+
+		color, ok := parseSGRColor(tokens[:5], false)
+		return color, 5, ok
+	}
+
+	return sgrColor{}, 0, false
+}
+
+// parseSGRColor parses "38;5;n", "38;2;r;g;b" and, in colon form, the
+// "38:2:colorspace:r:g:b" variant with an (often empty) color space id.
+func parseSGRColor(params []string, colon bool) (sgrColor, bool) {
+	if len(params) < 3 {
+		return sgrColor{}, false
+	}
+
+	target, err := strconv.Atoi(params[0])
+
+	if err != nil || (target != 38 && target != 48 && target != 58) {
+		return sgrColor{}, false
+	}
+
+	values := params[2:]
+
+	switch params[1] {
+	case "5":
+		index, err := strconv.Atoi(values[0])
+
+		if err != nil || index < 0 || index > 255 {
+			return sgrColor{}, false
+		}
+
+		return sgrColor{target: target, index: index, color: paletteColor(index)}, true
+
+	case "2":
+		if colon && len(values) == 4 {
+			values = values[1:]
+		}
+
+		if len(values) != 3 {
+			return sgrColor{}, false
+		}
+
+		var channels [3]int
+
+		for i, value := range values {
+			channel, err := strconv.Atoi(value)
+
+			if err != nil || channel < 0 || channel > 255 {
+				return sgrColor{}, false
+			}
+
+			channels[i] = channel
+		}
+
+		return sgrColor{target: target, index: -1, color: rgb(channels[0], channels[1], channels[2])}, true
+	}
+
+	return sgrColor{}, false
+}
+
+// formatSGRColor returns the SGR parameters for color in the given profile,
+// joined with separator when the color takes several parameters.
+func formatSGRColor(color sgrColor, profile string, separator string) []string {
+	switch profile {
+	case ColorProfileAscii:
+		return nil
+
+	case ColorProfileANSI256:
+		index := color.index
+
+		if index < 0 {
+			index = nearestANSI256(color.color)
+		}
+
+		return []string{strconv.Itoa(color.target) + separator + "5" + separator + strconv.Itoa(index)}
+
+	case ColorProfileANSI:
+		// Underline colors have no basic form
+		if color.target == 58 {
+			return nil
+		}
+
+		index := color.index
+
+		if index < 0 || index > 15 {
+			index = nearestANSI(color.color)
+		}
+
+		base := color.target - 8 // 30 or 40
+
+		if index >= 8 {
+			return []string{strconv.Itoa(base + 60 + index - 8)}
+		}
+
+		return []string{strconv.Itoa(base + index)}
+	}
+
+	return nil
+}
+
+// paletteColor returns the RGB value of a 256-color palette index.
+func paletteColor(index int) colorful.Color {
+	switch {
+	case index < 16:
+		return ansiPalette[index]
+	case index < 232:
+		index -= 16
+		return rgb(cubeLevels[index/36], cubeLevels[(index/6)%6], cubeLevels[index%6])
+	}
+
+	level := 8 + (index-232)*10
+
+	return rgb(level, level, level)
+}
+
+// nearestANSI256 maps color to the closer of the nearest color cube entry and
+// the nearest grayscale ramp entry.
+func nearestANSI256(color colorful.Color) int {
+	r, g, b := color.RGB255()
+
+	cubeIndex := func(value uint8) int {
+		switch {
+		case value < 48:
+			return 0
+		case value < 115:
+			return 1
+		}
+
+		return (int(value) - 35) / 40
+	}
+
+	cube := 16 + 36*cubeIndex(r) + 6*cubeIndex(g) + cubeIndex(b)
+
+	average := (int(r) + int(g) + int(b)) / 3
+	gray := 232 + 23
+
+	if average <= 238 {
+		gray = 232 + max(average-3, 0)/10
+	}
+
+	if color.DistanceHSLuv(paletteColor(gray)) < color.DistanceHSLuv(paletteColor(cube)) {
+		return gray
+	}
+
+	return cube
+}
+
+// nearestANSI maps color to the closest of the 16 basic colors.
+func nearestANSI(color colorful.Color) int {
+	nearest := 0
+	best := color.DistanceHSLuv(ansiPalette[0])
+
+	for index := 1; index < len(ansiPalette); index++ {
+		if distance := color.DistanceHSLuv(ansiPalette[index]); distance < best {
+			nearest, best = index, distance
+		}
+	}
+
+	return nearest
+}
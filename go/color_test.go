@@ -0,0 +1,59 @@
+package main
+
+import "testing"
+
+func TestConvertColors(t *testing.T) {
+	tests := []struct {
+		profile string
+		input   string
+		want    string
+	}{
+		{ColorProfileTrueColor, "\x1b[38;2;255;0;0mred\x1b[0m", "\x1b[38;2;255;0;0mred\x1b[0m"},
+
+		{ColorProfileANSI256, "\x1b[38;2;255;0;0mred\x1b[0m", "\x1b[38;5;196mred\x1b[0m"},
+		{ColorProfileANSI256, "\x1b[38:2::0:255:0mgreen", "\x1b[38:5:46mgreen"},
+		{ColorProfileANSI256, "\x1b[1;38;5;196;48;5;21mx\x1b[m", "\x1b[1;38;5;196;48;5;21mx\x1b[m"},
+
+		{ColorProfileANSI, "\x1b[38;2;255;0;0mred\x1b[0m", "\x1b[91mred\x1b[0m"},
+		{ColorProfileANSI, "\x1b[1;38;5;196;48;5;21mx\x1b[m", "\x1b[1;91;104mx\x1b[m"},
+		{ColorProfileANSI, "\x1b[38;5;1mred", "\x1b[31mred"},
+		{ColorProfileANSI, "\x1b[48;5;9mred", "\x1b[101mred"},
+		{ColorProfileANSI, "\x1b[38;5;244mgrey", "\x1b[90mgrey"},
+		{ColorProfileANSI, "\x1b[31;4mu", "\x1b[31;4mu"},
+
+		{ColorProfileAscii, "\x1b[38;2;255;0;0mred\x1b[0m", "red\x1b[0m"},
+		{ColorProfileAscii, "\x1b[1;38;5;196;48;5;21mx\x1b[m", "\x1b[1mx\x1b[m"},
+		{ColorProfileAscii, "\x1b[31;4mu", "\x1b[4mu"},
+		{ColorProfileAscii, "\x1b[91mbright", "bright"},
+		{ColorProfileAscii, "\x1b[2Kline", "\x1b[2Kline"},
+
+		{ColorProfileNoTTY, "\x1b[1;38;5;196mx\x1b[m", "x"},
+		{ColorProfileNoTTY, "\x1b[2Kline", "line"},
+	}
+
+	for _, test := range tests {
+		if got := ConvertColors(test.input, test.profile); got != test.want {
+			t.Errorf("ConvertColors(%q, %s) = %q, want %q", test.input, test.profile, got, test.want)
+		}
+	}
+}
+
+func TestConvertSGR(t *testing.T) {
+	tests := []struct {
+		params  string
+		profile string
+		want    string
+	}{
+		{"38;5;9", ColorProfileANSI, "\x1b[91m"},
+		{"38;2;0;0;0;48;2;255;255;255", ColorProfileANSI, "\x1b[30;107m"},
+		{"38;5;196", ColorProfileAscii, ""},
+		{"0;38;5;196", ColorProfileAscii, "\x1b[0m"},
+		{"", ColorProfileAscii, "\x1b[m"},
+	}
+
+	for _, test := range tests {
+		if got := convertSGR(test.params, test.profile); got != test.want {
+			t.Errorf("convertSGR(%q, %s) = %q, want %q", test.params, test.profile, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// Layer is a view drawn over the base view at an offset. Layers with a higher
+// Z are drawn later, on top; transparent layers let unstyled spaces show what
+// is underneath.
+type Layer struct {
+	Content     string `json:"content"`
+	X           int    `json:"x"`
+	Y           int    `json:"y"`
+	Z           int    `json:"z"`
+	Transparent bool   `json:"transparent"`
+}
+
+// Compose merges layers into base cell by cell and returns the combined view.
+// The result grows to fit layers that extend past the base; parts of layers
+// at negative offsets are clipped. Lines no layer covers are kept as they
+// are; covered lines are rebuilt from their cells, which keeps SGR styles
+// but drops other sequences, such as hyperlinks, and expands tabs.
+func Compose(base string, layers []Layer) string {
+	if len(layers) == 0 {
+		return base
+	}
+
+	lines := strings.Split(base, "\n")
+	canvas := parseCells(lines, 0)
+	covered := map[int]bool{}
+
+	sorted := make([]Layer, len(layers))
+	copy(sorted, layers)
+
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Z < sorted[j].Z })
+
+	for _, layer := range sorted {
+		for y, row := range parseCells(strings.Split(layer.Content, "\n"), 0) {
+			for x, cell := range row {
+				if cell.Width == 0 {
+					continue
+				}
+
+				if layer.Transparent && cell.Content == " " && cell.Style.Background == "" && !cell.Style.Reverse {
+					continue
+				}
+
+				if layer.X+x >= 0 && layer.Y+y >= 0 {
+					canvas = placeCell(canvas, layer.X+x, layer.Y+y, cell)
+					covered[layer.Y+y] = true
+				}
+			}
+		}
+	}
+
+	result := make([]string, len(canvas))
+
+	for y, row := range canvas {
+		if covered[y] || y >= len(lines) {
+			result[y] = formatCells([][]Cell{row})
+		} else {
+			result[y] = lines[y]
+		}
+	}
+
+	return strings.Join(result, "\n")
+}
+
+// placeCell writes cell into canvas at x, y, growing the canvas as needed and
+// blanking any wide grapheme the cell partly covers.
+func placeCell(canvas [][]Cell, x, y int, cell Cell) [][]Cell {
+	if x < 0 || y < 0 {
+		return canvas
+	}
+
+	for len(canvas) <= y {
+		canvas = append(canvas, nil)
+	}
+
+	row := canvas[y]
+
+	for len(row) < x+cell.Width {
+		row = append(row, blankCell)
+	}
+
+	for i := x; i < x+cell.Width; i++ {
+		clearWideCell(row, i)
+	}
+
+	row[x] = cell
+
+	for i := 1; i < cell.Width; i++ {
+		row[x+i] = Cell{Style: cell.Style}
+	}
+
+	canvas[y] = row
+
+	return canvas
+}
+
+// clearWideCell blanks the whole of a wide grapheme when one of its cells is
+// about to be overwritten.
+func clearWideCell(row []Cell, x int) {
+	start := x
+
+	for start > 0 && row[start].Width == 0 {
+		start--
+	}
+
+	width, style := row[start].Width, row[start].Style
+
+	if width <= 1 {
+		return
+	}
+
+	for i := start; i < start+width && i < len(row); i++ {
+		row[i] = Cell{Content: " ", Width: 1, Style: style}
+	}
+}
+
+// formatCells turns cells back into lines of text, emitting SGR only where the
+// style changes and resetting it at the end of each styled line.
+func formatCells(rows [][]Cell) string {
+	lines := make([]string, len(rows))
+
+	for y, row := range rows {
+		var (
+			line  strings.Builder
+			style CellStyle
+		)
+
+		for _, cell := range row {
+			if cell.Width == 0 {
+				continue
+			}
+
+			if cell.Style != style {
+				line.WriteString(cell.Style.Sequence())
+				style = cell.Style
+			}
+
+			line.WriteString(cell.Content)
+		}
+
+		if style != (CellStyle{}) {
+			line.WriteString(ansi.ResetStyle)
+		}
+
+		lines[y] = line.String()
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func parseLayers(layersJSON string) ([]Layer, bool) {
+	var layers []Layer
+
+	if err := json.Unmarshal([]byte(layersJSON), &layers); err != nil {
+		return nil, false
+	}
+
+	return layers, true
+}
+
+//export tea_compose
+func tea_compose(base *C.char, layersJSON *C.char) *C.char {
+	layers, ok := parseLayers(C.GoString(layersJSON))
+
+	if !ok {
+		return nil
+	}
+
+	return C.CString(Compose(C.GoString(base), layers))
+}
+
+//export tea_renderer_render_layers
+func tea_renderer_render_layers(id C.ulonglong, base *C.char, layersJSON *C.char) C.int {
+	renderer := getRenderer(uint64(id))
+
+	if renderer == nil {
+		return -1
+	}
+
+	layers, ok := parseLayers(C.GoString(layersJSON))
+
+	if !ok {
+		return -1
+	}
+
+	view := Compose(C.GoString(base), layers)
+
+	renderer.mu.Lock()
+	defer renderer.mu.Unlock()
+
+	renderer.view = view
+
+	if renderer.ticker == nil {
+		renderer.paint()
+	}
+
+	return 0
+}
@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+func TestComposeOverWideGraphemes(t *testing.T) {
+	tests := []struct {
+		base   string
+		layers []Layer
+		want   string
+	}{
+		// The layer covers the left half of 日
+		{"x日yz", []Layer{{Content: "a", X: 1}}, "xa yz"},
+		// The layer covers the right half of 日
+		{"x日yz", []Layer{{Content: "a", X: 2}}, "x ayz"},
+		// The layer's wide grapheme covers the left half of 日
+		{"x日日z", []Layer{{Content: "世", X: 0}}, "世 日z"},
+	}
+
+	for _, test := range tests {
+		if got := Compose(test.base, test.layers); got != test.want {
+			t.Errorf("Compose(%q, %+v) = %q, want %q", test.base, test.layers, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"strings"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+// Cursor shapes, combined with blinking into a DECSCUSR style.
+const (
+	CursorBlock     = 0
+	CursorUnderline = 1
+	CursorBar       = 2
+)
+
+// FrameCursor is where and how the real terminal cursor is shown once a frame
+// is drawn. X and Y are relative to the frame's top-left cell.
+type FrameCursor struct {
+	X, Y  int
+	Shape int
+	Blink bool
+	Color string // "#rrggbb", or empty for the terminal's default
+}
+
+// style returns the DECSCUSR parameter for the cursor's shape.
+func (cursor FrameCursor) style() int {
+	style := cursor.Shape*2 + 1
+
+	if !cursor.Blink {
+		style++
+	}
+
+	return style
+}
+
+// cursorChanged reports whether the cursor on screen differs from the one
+// the frame asks for.
+func (renderer *Renderer) cursorChanged() bool {
+	if renderer.cursor == nil {
+		return !renderer.isCursorHidden()
+	}
+
+	cursor := *renderer.cursor
+
+	return renderer.isCursorHidden() || !renderer.cursorPlaced ||
+		renderer.placedX != cursor.X || renderer.placedY != cursor.Y ||
+		renderer.cursorStyle != cursor.style() || renderer.cursorColor != cursor.Color
+}
+
+// placeCursor returns the output that moves the real cursor to the frame's
+// cursor and shows it, or hides it when the frame has none. In inline mode,
+// the cursor must be at the start of the frame's last line.
+func (renderer *Renderer) placeCursor() string {
+	if renderer.cursor == nil {
+		return renderer.setCursorVisible(false)
+	}
+
+	var buffer strings.Builder
+
+	cursor := *renderer.cursor
+	last := max(renderer.linesRendered-1, 0)
+	y := min(max(cursor.Y, 0), last)
+	x := max(cursor.X, 0)
+
+	if renderer.width > 0 {
+		x = min(x, renderer.width-1)
+	}
+
+	if renderer.altScreen {
+		buffer.WriteString(ansi.CursorPosition(x+1, y+1))
+	} else {
+		if y < last {
+			buffer.WriteString(ansi.CursorUp(last - y))
+		}
+
+		buffer.WriteString("\r")
+
+		if x > 0 {
+			buffer.WriteString(ansi.CursorForward(x))
+		}
+	}
+
+	if style := cursor.style(); style != renderer.cursorStyle {
+		buffer.WriteString(ansi.SetCursorStyle(style))
+		renderer.cursorStyle = style
+	}
+
+	if cursor.Color != renderer.cursorColor {
+		if color, err := colorful.Hex(cursor.Color); err == nil {
+			buffer.WriteString(ansi.SetCursorColor(color))
+		} else {
+			buffer.WriteString(ansi.ResetCursorColor)
+		}
+
+		renderer.cursorColor = cursor.Color
+	}
+
+	buffer.WriteString(renderer.setCursorVisible(true))
+
+	// Remember where the cursor was asked to be so an unchanged frame
+	// doesn't move it again
+	renderer.cursorPlaced = true
+	renderer.placedX, renderer.placedY = cursor.X, cursor.Y
+	renderer.placedRow = y
+
+	return buffer.String()
+}
+
+// returnCursor returns the output that moves a placed cursor back to the
+// start of the frame's last line, where the diffs expect it.
+func (renderer *Renderer) returnCursor() string {
+	if !renderer.cursorPlaced {
+		return ""
+	}
+
+	renderer.cursorPlaced = false
+
+	if renderer.altScreen {
+		return ""
+	}
+
+	output := "\r"
+
+	if last := max(renderer.linesRendered-1, 0); renderer.placedRow < last {
+		output = ansi.CursorDown(last-renderer.placedRow) + output
+	}
+
+	return output
+}
+
+// resetCursor returns the output that hands the cursor back in the state the
+// program found it: at the end of the frame, with the default style and color.
+func (renderer *Renderer) resetCursor() string {
+	output := renderer.returnCursor()
+
+	if renderer.cursorStyle != 0 {
+		output += ansi.SetCursorStyle(0)
+		renderer.cursorStyle = 0
+	}
+
+	if renderer.cursorColor != "" {
+		output += ansi.ResetCursorColor
+		renderer.cursorColor = ""
+	}
+
+	return output
+}
+
+func (renderer *Renderer) isCursorHidden() bool {
+	if renderer.program != nil && renderer.program.terminal != nil {
+		return renderer.program.terminal.isCursorHidden()
+	}
+
+	return renderer.cursorHidden
+}
+
+// setCursorVisible returns the sequence that shows or hides the cursor, and
+// keeps the terminal's record of it in sync so restoring it still works.
+func (renderer *Renderer) setCursorVisible(visible bool) string {
+	if renderer.program != nil && renderer.program.terminal != nil {
+		if !renderer.program.terminal.setCursorHidden(!visible) {
+			return ""
+		}
+	} else if renderer.cursorHidden == !visible {
+		return ""
+	}
+
+	renderer.cursorHidden = !visible
+
+	if visible {
+		return ansi.ShowCursor
+	}
+
+	return ansi.HideCursor
+}
+
+//export tea_renderer_set_cursor
+func tea_renderer_set_cursor(id C.ulonglong, x C.int, y C.int, shape C.int, blink C.int, color *C.char) {
+	renderer := getRenderer(uint64(id))
+
+	if renderer == nil {
+		return
+	}
+
+	renderer.mu.Lock()
+	defer renderer.mu.Unlock()
+
+	renderer.cursor = &FrameCursor{
+		X:     int(x),
+		Y:     int(y),
+		Shape: min(max(int(shape), CursorBlock), CursorBar),
+		Blink: blink != 0,
+		Color: C.GoString(color),
+	}
+
+	if renderer.ticker == nil {
+		renderer.paint()
+	}
+}
+
+//export tea_renderer_hide_cursor
+func tea_renderer_hide_cursor(id C.ulonglong) {
+	renderer := getRenderer(uint64(id))
+
+	if renderer == nil {
+		return
+	}
+
+	renderer.mu.Lock()
+	defer renderer.mu.Unlock()
+
+	renderer.cursor = nil
+
+	if renderer.ticker == nil {
+		renderer.paint()
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import "testing"
+
+func TestPlaceCursorInAltScreen(t *testing.T) {
+	renderer, buffer := newBufferedRenderer(10, 5)
+	renderer.altScreen = true
+	renderer.cursor = &FrameCursor{X: 2, Y: 1, Shape: CursorBar, Color: "#ff0000"}
+
+	renderer.view = "ab\ncd"
+	renderer.paint()
+
+	if got, want := buffer.Drain(), "\x1b[1;1Hab\x1b[K\x1b[2;1Hcd\x1b[K\x1b[2;3H\x1b[6 q\x1b]12;#ff0000\a"; got != want {
+		t.Errorf("paint() = %q, want %q", got, want)
+	}
+
+	renderer.Stop()
+
+	if got, want := buffer.Drain(), "\x1b[0 q\x1b]112\a"; got != want {
+		t.Errorf("Stop() = %q, want %q", got, want)
+	}
+}
+
+func TestPlaceCursorInlineReturnsToFrameEndOnStop(t *testing.T) {
+	renderer, buffer := newBufferedRenderer(10, 5)
+	renderer.cursor = &FrameCursor{X: 1, Y: 0, Shape: CursorUnderline, Blink: true}
+
+	renderer.view = "ab\ncd"
+	renderer.paint()
+
+	if got, want := buffer.Drain(), "\rab\x1b[K\r\ncd\x1b[K\r\x1b[A\r\x1b[C\x1b[3 q"; got != want {
+		t.Errorf("paint() = %q, want %q", got, want)
+	}
+
+	renderer.paint()
+
+	if got := buffer.Drain(); got != "" {
+		t.Errorf("paint() of an unchanged frame = %q, want no output", got)
+	}
+
+	renderer.Stop()
+
+	if got, want := buffer.Drain(), "\x1b[B\r\x1b[0 q"; got != want {
+		t.Errorf("Stop() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"sync"
+	"time"
+)
+
+// DefaultEscapeTimeout is how long a lone ESC or a partial escape sequence is
+// held back waiting for the rest of its bytes.
+const DefaultEscapeTimeout = 50 * time.Millisecond
+
+// InputDecoder turns the raw chunks produced by an InputReader into events.
+// Sequences split across reads are reassembled, and an incomplete sequence is
+// only flushed once no further bytes arrive within the escape timeout. A
+// bracketed paste is buffered until its end marker, however long it takes.
+type InputDecoder struct {
+	mu            sync.Mutex
+	buffer        []byte
+	pasting       bool
+	escapeTimeout time.Duration
+	lastInput     time.Time
+
+	// Set while a cursor position query is outstanding
+	expectCursorPosition bool
+}
+
+func NewInputDecoder(escapeTimeout time.Duration) *InputDecoder {
+	return &InputDecoder{
+		escapeTimeout: escapeTimeout,
+	}
+}
+
+func (decoder *InputDecoder) SetEscapeTimeout(timeout time.Duration) {
+	decoder.mu.Lock()
+	defer decoder.mu.Unlock()
+
+	decoder.escapeTimeout = timeout
+}
+
+func (decoder *InputDecoder) SetExpectCursorPosition(expect bool) {
+	decoder.mu.Lock()
+	defer decoder.mu.Unlock()
+
+	decoder.expectCursorPosition = expect
+}
+
+// Feed appends data to the decoder and returns every event that is complete.
+func (decoder *InputDecoder) Feed(data []byte, now time.Time) []string {
+	decoder.mu.Lock()
+	defer decoder.mu.Unlock()
+
+	decoder.buffer = append(decoder.buffer, data...)
+	decoder.lastInput = now
+
+	if decoder.pasting {
+		// Only the new bytes (and a possibly split marker) need to be searched
+		searchFrom := max(len(decoder.buffer)-len(data)-len(pasteEnd)+1, 0)
+
+		if !bytes.Contains(decoder.buffer[searchFrom:], []byte(pasteEnd)) {
+			return nil
+		}
+	}
+
+	events, consumed := parseEvents(decoder.buffer, false, decoder.expectCursorPosition)
+	decoder.buffer = append(decoder.buffer[:0], decoder.buffer[consumed:]...)
+	decoder.pasting = bytes.HasPrefix(decoder.buffer, []byte(pasteStart))
+
+	return events
+}
+
+// Deadline returns when the pending partial sequence expires, if there is one.
+func (decoder *InputDecoder) Deadline() (time.Time, bool) {
+	decoder.mu.Lock()
+	defer decoder.mu.Unlock()
+
+	if len(decoder.buffer) == 0 || decoder.pasting {
+		return time.Time{}, false
+	}
+
+	return decoder.lastInput.Add(decoder.escapeTimeout), true
+}
+
+// Expire flushes the pending bytes as-is once the escape timeout has passed,
+// so a lone ESC is reported as the esc key.
+func (decoder *InputDecoder) Expire(now time.Time) []string {
+	decoder.mu.Lock()
+	defer decoder.mu.Unlock()
+
+	if len(decoder.buffer) == 0 || decoder.pasting || now.Before(decoder.lastInput.Add(decoder.escapeTimeout)) {
+		return nil
+	}
+
+	events, _ := parseEvents(decoder.buffer, true, decoder.expectCursorPosition)
+	decoder.buffer = decoder.buffer[:0]
+
+	return events
+}
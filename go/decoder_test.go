@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// feedAll feeds each part to a new decoder and expires whatever is left.
+func feedAll(t *testing.T, parts ...string) []map[string]any {
+	t.Helper()
+
+	decoder := NewInputDecoder(DefaultEscapeTimeout)
+	now := time.Now()
+
+	var events []string
+
+	for _, part := range parts {
+		events = append(events, decoder.Feed([]byte(part), now)...)
+	}
+
+	events = append(events, decoder.Expire(now.Add(DefaultEscapeTimeout))...)
+
+	decoded := make([]map[string]any, len(events))
+
+	for i, event := range events {
+		if err := json.Unmarshal([]byte(event), &decoded[i]); err != nil {
+			t.Fatalf("invalid event %q: %v", event, err)
+		}
+	}
+
+	return decoded
+}
+
+// names returns the type of each event, or its name for key events.
+func names(events []map[string]any) []string {
+	result := make([]string, len(events))
+
+	for i, event := range events {
+		if event["type"] == "key" {
+			result[i] = event["name"].(string)
+		} else {
+			result[i] = event["type"].(string)
+		}
+	}
+
+	return result
+}
+
+func TestDecoderJoinsSplitSequences(t *testing.T) {
+	tests := []struct {
+		parts []string
+		want  []string
+	}{
+		{[]string{"\x1b[1;5", "B"}, []string{"ctrl+down"}},
+		{[]string{"\x1b", "[A"}, []string{"up"}},
+		{[]string{"\x1bO", "P"}, []string{"f1"}},
+		{[]string{"\x1b]11;rgb:0000/", "0000/0000\x1b\\"}, []string{"background_color"}},
+		{[]string{"\xe6\x97", "\xa5"}, []string{"日"}},
+		{[]string{"\x1b[?2026;2$", "y"}, []string{"mode_report"}},
+		{[]string{"\x1b[4;2$", "y"}, []string{"mode_report"}},
+	}
+
+	for _, test := range tests {
+		if got := names(feedAll(t, test.parts...)); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Feed(%q) = %q, want %q", test.parts, got, test.want)
+		}
+	}
+}
+
+func TestDecoderKeepsRxvtShiftedKeys(t *testing.T) {
+	decoder := NewInputDecoder(DefaultEscapeTimeout)
+
+	if got := decoder.Feed([]byte("\x1b[2$"), time.Now()); len(got) != 1 {
+		t.Fatalf("Feed() = %q, want one event", got)
+	}
+
+	if _, pending := decoder.Deadline(); pending {
+		t.Error("Deadline() pending after a complete rxvt key")
+	}
+}
+
+func TestDecoderExpiresLoneEscape(t *testing.T) {
+	decoder := NewInputDecoder(DefaultEscapeTimeout)
+	now := time.Now()
+
+	if got := decoder.Feed([]byte("\x1b"), now); len(got) != 0 {
+		t.Fatalf("Feed() = %q, want no events", got)
+	}
+
+	deadline, pending := decoder.Deadline()
+
+	if !pending || !deadline.Equal(now.Add(DefaultEscapeTimeout)) {
+		t.Fatalf("Deadline() = %v, %v, want %v, true", deadline, pending, now.Add(DefaultEscapeTimeout))
+	}
+
+	if got := decoder.Expire(deadline.Add(-time.Millisecond)); len(got) != 0 {
+		t.Errorf("Expire() before deadline = %q, want no events", got)
+	}
+
+	events := decoder.Expire(deadline)
+
+	if len(events) != 1 {
+		t.Fatalf("Expire() = %q, want one event", events)
+	}
+
+	var event map[string]any
+
+	if err := json.Unmarshal([]byte(events[0]), &event); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := event["name"], "esc"; got != want {
+		t.Errorf("Expire() name = %v, want %q", got, want)
+	}
+
+	if _, pending := decoder.Deadline(); pending {
+		t.Error("Deadline() still pending after Expire()")
+	}
+}
+
+func TestDecoderJoinsSplitPaste(t *testing.T) {
+	tests := [][]string{
+		{"\x1b[200~one\r", "\ntwo\rthree\x1b[201~"},
+		{"\x1b[200~one\r\ntwo\rthree\x1b[2", "01~"},
+		{"\x1b[20", "0~one\r\ntwo\rthree\x1b[201~"},
+	}
+
+	for _, parts := range tests {
+		events := feedAll(t, parts...)
+
+		if got, want := names(events), []string{"paste"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Feed(%q) = %q, want %q", parts, got, want)
+			continue
+		}
+
+		if got, want := events[0]["content"], "one\ntwo\nthree"; got != want {
+			t.Errorf("Feed(%q) content = %q, want %q", parts, got, want)
+		}
+	}
+}
@@ -0,0 +1,792 @@
+package main
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// Emulator is an in-process virtual terminal. It interprets what programs and
+// renderers write to it into a grid of cells, so tests can assert on what a
+// user would see, and it feeds programs input through a pipe.
+type Emulator struct {
+	mu            sync.Mutex
+	width         int
+	height        int
+	main          [][]Cell
+	alt           [][]Cell
+	altScreen     bool
+	x, y          int
+	pendingWrap   bool
+	savedX        int
+	savedY        int
+	savedPen      CellStyle
+	pen           CellStyle
+	scrollTop     int
+	scrollBottom  int
+	autowrap      bool
+	cursorVisible bool
+	cursorStyle   int
+	title         string
+	lastGrapheme  string
+	partial       []byte
+	inputReader   *os.File
+	inputWriter   *os.File
+}
+
+// emulatorPrimaryAttributes is the DA1 reply: a VT220 with ANSI color.
+const emulatorPrimaryAttributes = "\x1b[?62;22c"
+
+var (
+	emulators   = make(map[uint64]*Emulator)
+	emulatorsMu sync.RWMutex
+)
+
+func getEmulator(id uint64) *Emulator {
+	emulatorsMu.RLock()
+	defer emulatorsMu.RUnlock()
+	return emulators[id]
+}
+
+// NewEmulator returns an emulator with a blank screen of the given size.
+func NewEmulator(width, height int) (*Emulator, error) {
+	inputReader, inputWriter, err := os.Pipe()
+
+	if err != nil {
+		return nil, err
+	}
+
+	emulator := &Emulator{
+		autowrap:      true,
+		cursorVisible: true,
+		inputReader:   inputReader,
+		inputWriter:   inputWriter,
+	}
+
+	emulator.resize(max(width, 1), max(height, 1))
+
+	return emulator, nil
+}
+
+// Close releases the input pipe; programs reading from it see end of file.
+func (emulator *Emulator) Close() {
+	emulator.inputWriter.Close()
+	emulator.inputReader.Close()
+}
+
+// Size returns the screen size in cells.
+func (emulator *Emulator) Size() (int, int) {
+	emulator.mu.Lock()
+	defer emulator.mu.Unlock()
+
+	return emulator.width, emulator.height
+}
+
+// ColorProfile reports that the emulator keeps every color as written.
+func (emulator *Emulator) ColorProfile() string {
+	return ColorProfileTrueColor
+}
+
+// SendInput queues data as if the user had typed it.
+func (emulator *Emulator) SendInput(data string) {
+	emulator.inputWriter.WriteString(data)
+}
+
+// Write interprets output. Sequences split across writes are completed by
+// the next write.
+func (emulator *Emulator) Write(data []byte) (int, error) {
+	emulator.mu.Lock()
+	defer emulator.mu.Unlock()
+
+	input := string(emulator.partial) + string(data)
+	emulator.partial = nil
+
+	var state byte
+
+	for len(input) > 0 {
+		if !utf8.FullRuneInString(input) {
+			emulator.partial = []byte(input)
+			break
+		}
+
+		sequence, width, n, newState := ansi.DecodeSequence(input, state, nil)
+
+		if n == len(input) && newState != ansi.NormalState {
+			emulator.partial = []byte(input)
+			break
+		}
+
+		state = newState
+		input = input[n:]
+
+		if width > 0 {
+			emulator.print(sequence, width)
+			continue
+		}
+
+		emulator.handle(sequence)
+	}
+
+	return len(data), nil
+}
+
+func (emulator *Emulator) screen() [][]Cell {
+	if emulator.altScreen {
+		return emulator.alt
+	}
+
+	return emulator.main
+}
+
+func (emulator *Emulator) blankRow() []Cell {
+	row := make([]Cell, emulator.width)
+
+	for x := range row {
+		row[x] = emulator.blank()
+	}
+
+	return row
+}
+
+// blank is an erased cell, which keeps the pen's background like xterm does.
+func (emulator *Emulator) blank() Cell {
+	return Cell{Content: " ", Width: 1, Style: CellStyle{Background: emulator.pen.Background}}
+}
+
+func (emulator *Emulator) resize(width, height int) {
+	resizeScreen := func(screen [][]Cell) [][]Cell {
+		resized := make([][]Cell, height)
+
+		for y := range resized {
+			resized[y] = make([]Cell, width)
+
+			for x := range resized[y] {
+				resized[y][x] = blankCell
+
+				if y < len(screen) && x < len(screen[y]) {
+					resized[y][x] = screen[y][x]
+				}
+			}
+		}
+
+		return resized
+	}
+
+	emulator.width, emulator.height = width, height
+	emulator.main = resizeScreen(emulator.main)
+	emulator.alt = resizeScreen(emulator.alt)
+	emulator.scrollTop, emulator.scrollBottom = 0, height-1
+	emulator.x = min(emulator.x, width-1)
+	emulator.y = min(emulator.y, height-1)
+	emulator.pendingWrap = false
+}
+
+// print puts a grapheme at the cursor and advances it, wrapping at the right
+// margin when autowrap is on.
+func (emulator *Emulator) print(grapheme string, width int) {
+	if emulator.pendingWrap && emulator.autowrap {
+		emulator.x = 0
+		emulator.lineFeed()
+	}
+
+	emulator.pendingWrap = false
+
+	if emulator.x+width > emulator.width {
+		if !emulator.autowrap || width > emulator.width {
+			return
+		}
+
+		emulator.x = 0
+		emulator.lineFeed()
+	}
+
+	row := emulator.screen()[emulator.y]
+
+	emulator.clearWide(row, emulator.x)
+	emulator.clearWide(row, emulator.x+width-1)
+
+	row[emulator.x] = Cell{Content: grapheme, Width: width, Style: emulator.pen}
+
+	for i := 1; i < width; i++ {
+		row[emulator.x+i] = Cell{Style: emulator.pen}
+	}
+
+	emulator.lastGrapheme = grapheme
+	emulator.x += width
+
+	if emulator.x >= emulator.width {
+		emulator.x = emulator.width - 1
+		emulator.pendingWrap = true
+	}
+}
+
+// clearWide blanks the rest of a wide grapheme that a write at x overlaps.
+func (emulator *Emulator) clearWide(row []Cell, x int) {
+	if x >= 0 && x < len(row) {
+		clearWideCell(row, x)
+	}
+}
+
+func (emulator *Emulator) lineFeed() {
+	switch {
+	case emulator.y == emulator.scrollBottom:
+		emulator.scrollUp(1)
+	case emulator.y < emulator.height-1:
+		emulator.y++
+	}
+}
+
+func (emulator *Emulator) reverseIndex() {
+	switch {
+	case emulator.y == emulator.scrollTop:
+		emulator.scrollDown(1)
+	case emulator.y > 0:
+		emulator.y--
+	}
+}
+
+// scrollUp moves the lines of the scroll region up by n, blanking the bottom.
+func (emulator *Emulator) scrollUp(n int) {
+	emulator.deleteLines(emulator.scrollTop, n)
+}
+
+// scrollDown moves the lines of the scroll region down by n, blanking the top.
+func (emulator *Emulator) scrollDown(n int) {
+	emulator.insertLines(emulator.scrollTop, n)
+}
+
+// insertLines inserts n blank lines at row y, pushing the lines below it
+// towards the bottom of the scroll region.
+func (emulator *Emulator) insertLines(y, n int) {
+	screen := emulator.screen()
+	bottom := emulator.scrollBottom
+	n = min(n, bottom-y+1)
+
+	copy(screen[y+n:bottom+1], screen[y:bottom+1-n])
+
+	for i := y; i < y+n; i++ {
+		screen[i] = emulator.blankRow()
+	}
+}
+
+// deleteLines removes n lines at row y, pulling the lines below it up and
+// blanking the bottom of the scroll region.
+func (emulator *Emulator) deleteLines(y, n int) {
+	screen := emulator.screen()
+	bottom := emulator.scrollBottom
+	n = min(n, bottom-y+1)
+
+	copy(screen[y:bottom+1-n], screen[y+n:bottom+1])
+
+	for i := bottom + 1 - n; i <= bottom; i++ {
+		screen[i] = emulator.blankRow()
+	}
+}
+
+func (emulator *Emulator) eraseCells(y, from, to int) {
+	row := emulator.screen()[y]
+
+	emulator.clearWide(row, from)
+	emulator.clearWide(row, to-1)
+
+	for x := max(from, 0); x < min(to, emulator.width); x++ {
+		row[x] = emulator.blank()
+	}
+}
+
+func (emulator *Emulator) moveCursor(x, y int) {
+	emulator.x = min(max(x, 0), emulator.width-1)
+	emulator.y = min(max(y, 0), emulator.height-1)
+	emulator.pendingWrap = false
+}
+
+func (emulator *Emulator) setAltScreen(enabled bool, saveCursor bool) {
+	if emulator.altScreen == enabled {
+		return
+	}
+
+	if enabled && saveCursor {
+		emulator.saveCursor()
+	}
+
+	emulator.altScreen = enabled
+
+	if enabled {
+		for y := range emulator.alt {
+			emulator.alt[y] = emulator.blankRow()
+		}
+	} else if saveCursor {
+		emulator.restoreCursor()
+	}
+}
+
+func (emulator *Emulator) saveCursor() {
+	emulator.savedX, emulator.savedY, emulator.savedPen = emulator.x, emulator.y, emulator.pen
+}
+
+func (emulator *Emulator) restoreCursor() {
+	emulator.moveCursor(emulator.savedX, emulator.savedY)
+	emulator.pen = emulator.savedPen
+}
+
+// reply answers a terminal query through the input pipe.
+func (emulator *Emulator) reply(response string) {
+	emulator.inputWriter.WriteString(response)
+}
+
+// handle interprets a control character or escape sequence.
+func (emulator *Emulator) handle(sequence string) {
+	switch {
+	case sequence == "\r":
+		emulator.x = 0
+		emulator.pendingWrap = false
+	case sequence == "\n" || sequence == "\x0b" || sequence == "\x0c":
+		emulator.lineFeed()
+		emulator.pendingWrap = false
+	case sequence == "\b":
+		emulator.moveCursor(emulator.x-1, emulator.y)
+	case sequence == "\t":
+		emulator.moveCursor((emulator.x/tabWidth+1)*tabWidth, emulator.y)
+	case strings.HasPrefix(sequence, "\x1b["):
+		emulator.handleCSI(sequence)
+	case strings.HasPrefix(sequence, "\x1b]"):
+		emulator.handleOSC(sequence)
+	case len(sequence) == 2 && sequence[0] == 0x1b:
+		emulator.handleEscape(sequence[1])
+	}
+}
+
+func (emulator *Emulator) handleEscape(final byte) {
+	switch final {
+	case '7':
+		emulator.saveCursor()
+	case '8':
+		emulator.restoreCursor()
+	case 'D':
+		emulator.lineFeed()
+	case 'E':
+		emulator.x = 0
+		emulator.lineFeed()
+	case 'M':
+		emulator.reverseIndex()
+	case 'c':
+		emulator.reset()
+	}
+}
+
+// reset returns the emulator to its initial state, as RIS does.
+func (emulator *Emulator) reset() {
+	emulator.pen = CellStyle{}
+	emulator.altScreen = false
+	emulator.main, emulator.alt = nil, nil
+	emulator.x, emulator.y = 0, 0
+	emulator.savedX, emulator.savedY, emulator.savedPen = 0, 0, CellStyle{}
+	emulator.autowrap = true
+	emulator.cursorVisible = true
+	emulator.cursorStyle = 0
+	emulator.title = ""
+	emulator.lastGrapheme = ""
+	emulator.resize(emulator.width, emulator.height)
+}
+
+func (emulator *Emulator) handleOSC(sequence string) {
+	body := strings.TrimSuffix(strings.TrimSuffix(sequence[2:], "\x07"), stringTerminator)
+	command, value, _ := strings.Cut(body, ";")
+
+	if command == "0" || command == "2" {
+		emulator.title = value
+	}
+}
+
+func (emulator *Emulator) handleCSI(sequence string) {
+	body := sequence[2 : len(sequence)-1]
+	final := sequence[len(sequence)-1]
+
+	var marker, intermediate byte
+
+	if len(body) > 0 && body[0] >= '<' && body[0] <= '?' {
+		marker = body[0]
+		body = body[1:]
+	}
+
+	if len(body) > 0 && body[len(body)-1] >= 0x20 && body[len(body)-1] <= 0x2f {
+		intermediate = body[len(body)-1]
+		body = body[:len(body)-1]
+	}
+
+	rawParams := strings.Split(body, ";")
+
+	param := func(index, fallback int) int {
+		if index >= len(rawParams) {
+			return fallback
+		}
+
+		value, err := strconv.Atoi(strings.SplitN(rawParams[index], ":", 2)[0])
+
+		if err != nil || value == 0 {
+			return fallback
+		}
+
+		return value
+	}
+
+	if marker == '?' {
+		emulator.handlePrivateCSI(final, intermediate, rawParams, param)
+		return
+	}
+
+	if marker != 0 {
+		return
+	}
+
+	switch intermediate {
+	case ' ':
+		if final == 'q' {
+			emulator.cursorStyle = param(0, 0)
+		}
+
+		return
+	case 0:
+	default:
+		return
+	}
+
+	x, y := emulator.x, emulator.y
+
+	switch final {
+	case 'A':
+		emulator.moveCursor(x, max(y-param(0, 1), min(emulator.scrollTop, y)))
+	case 'B':
+		emulator.moveCursor(x, min(y+param(0, 1), max(emulator.scrollBottom, y)))
+	case 'C':
+		emulator.moveCursor(x+param(0, 1), y)
+	case 'D':
+		emulator.moveCursor(x-param(0, 1), y)
+	case 'E':
+		emulator.moveCursor(0, y+param(0, 1))
+	case 'F':
+		emulator.moveCursor(0, y-param(0, 1))
+	case 'G', '`':
+		emulator.moveCursor(param(0, 1)-1, y)
+	case 'd':
+		emulator.moveCursor(x, param(0, 1)-1)
+	case 'H', 'f':
+		emulator.moveCursor(param(1, 1)-1, param(0, 1)-1)
+	case 'J':
+		switch param(0, 0) {
+		case 0:
+			emulator.eraseCells(y, x, emulator.width)
+
+			for row := y + 1; row < emulator.height; row++ {
+				emulator.eraseCells(row, 0, emulator.width)
+			}
+		case 1:
+			emulator.eraseCells(y, 0, x+1)
+
+			for row := 0; row < y; row++ {
+				emulator.eraseCells(row, 0, emulator.width)
+			}
+		case 2, 3:
+			for row := 0; row < emulator.height; row++ {
+				emulator.eraseCells(row, 0, emulator.width)
+			}
+		}
+	case 'K':
+		switch param(0, 0) {
+		case 0:
+			emulator.eraseCells(y, x, emulator.width)
+		case 1:
+			emulator.eraseCells(y, 0, x+1)
+		case 2:
+			emulator.eraseCells(y, 0, emulator.width)
+		}
+	case 'X':
+		emulator.eraseCells(y, x, x+param(0, 1))
+	case 'b':
+		for i := 0; i < param(0, 1) && emulator.lastGrapheme != ""; i++ {
+			emulator.print(emulator.lastGrapheme, max(ansi.StringWidth(emulator.lastGrapheme), 1))
+		}
+	case '@':
+		row := emulator.screen()[y]
+		n := min(param(0, 1), emulator.width-x)
+
+		copy(row[x+n:], row[x:emulator.width-n])
+		emulator.eraseCells(y, x, x+n)
+	case 'P':
+		row := emulator.screen()[y]
+		n := min(param(0, 1), emulator.width-x)
+
+		copy(row[x:], row[x+n:])
+		emulator.eraseCells(y, emulator.width-n, emulator.width)
+	case 'L':
+		if y >= emulator.scrollTop && y <= emulator.scrollBottom {
+			emulator.insertLines(y, param(0, 1))
+			emulator.x = 0
+		}
+	case 'M':
+		if y >= emulator.scrollTop && y <= emulator.scrollBottom {
+			emulator.deleteLines(y, param(0, 1))
+			emulator.x = 0
+		}
+	case 'S':
+		emulator.scrollUp(param(0, 1))
+	case 'T':
+		emulator.scrollDown(param(0, 1))
+	case 'r':
+		top, bottom := param(0, 1)-1, param(1, emulator.height)-1
+
+		if top < bottom && bottom < emulator.height {
+			emulator.scrollTop, emulator.scrollBottom = top, bottom
+			emulator.moveCursor(0, 0)
+		}
+	case 'm':
+		emulator.pen.apply(body)
+	case 's':
+		emulator.saveCursor()
+	case 'u':
+		emulator.restoreCursor()
+	case 'n':
+		if param(0, 0) == 6 {
+			emulator.reply(fmt.Sprintf("\x1b[%d;%dR", y+1, x+1))
+		}
+	case 'c':
+		emulator.reply(emulatorPrimaryAttributes)
+	}
+}
+
+func (emulator *Emulator) handlePrivateCSI(final, intermediate byte, rawParams []string, param func(int, int) int) {
+	if intermediate == '$' && final == 'p' {
+		// DECRQM: report every mode as not recognized
+		emulator.reply(fmt.Sprintf("\x1b[?%d;0$y", param(0, 0)))
+		return
+	}
+
+	if intermediate != 0 || (final != 'h' && final != 'l') {
+		return
+	}
+
+	enabled := final == 'h'
+
+	for index := range rawParams {
+		switch param(index, 0) {
+		case 7:
+			emulator.autowrap = enabled
+		case 25:
+			emulator.cursorVisible = enabled
+		case 47, 1047:
+			emulator.setAltScreen(enabled, false)
+		case 1049:
+			emulator.setAltScreen(enabled, true)
+		}
+	}
+}
+
+// Text returns the screen as plain text, one line per row, without trailing
+// spaces or trailing blank rows.
+func (emulator *Emulator) Text() string {
+	emulator.mu.Lock()
+	defer emulator.mu.Unlock()
+
+	lines := make([]string, 0, emulator.height)
+
+	for _, row := range emulator.screen() {
+		var line strings.Builder
+
+		for _, cell := range row {
+			line.WriteString(cell.Content)
+		}
+
+		lines = append(lines, strings.TrimRight(line.String(), " "))
+	}
+
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// CellAt returns the cell at column x of row y, and false when it is off
+// screen.
+func (emulator *Emulator) CellAt(x, y int) (Cell, bool) {
+	emulator.mu.Lock()
+	defer emulator.mu.Unlock()
+
+	if x < 0 || y < 0 || x >= emulator.width || y >= emulator.height {
+		return Cell{}, false
+	}
+
+	return emulator.screen()[y][x], true
+}
+
+// EmulatorState is the emulator's state besides the screen contents.
+type EmulatorState struct {
+	Width         int    `json:"width"`
+	Height        int    `json:"height"`
+	CursorX       int    `json:"cursor_x"`
+	CursorY       int    `json:"cursor_y"`
+	CursorVisible bool   `json:"cursor_visible"`
+	CursorStyle   int    `json:"cursor_style"`
+	AltScreen     bool   `json:"alt_screen"`
+	Title         string `json:"title"`
+}
+
+func (emulator *Emulator) State() EmulatorState {
+	emulator.mu.Lock()
+	defer emulator.mu.Unlock()
+
+	return EmulatorState{
+		Width:         emulator.width,
+		Height:        emulator.height,
+		CursorX:       emulator.x,
+		CursorY:       emulator.y,
+		CursorVisible: emulator.cursorVisible,
+		CursorStyle:   emulator.cursorStyle,
+		AltScreen:     emulator.altScreen,
+		Title:         emulator.title,
+	}
+}
+
+// Resize changes the screen size, keeping the top-left part of the contents.
+func (emulator *Emulator) Resize(width, height int) {
+	emulator.mu.Lock()
+	defer emulator.mu.Unlock()
+
+	emulator.resize(max(width, 1), max(height, 1))
+}
+
+//export tea_emulator_new
+func tea_emulator_new(width C.int, height C.int) C.ulonglong {
+	emulator, err := NewEmulator(int(width), int(height))
+
+	if err != nil {
+		return 0
+	}
+
+	emulatorsMu.Lock()
+	id := getNextID()
+	emulators[id] = emulator
+	emulatorsMu.Unlock()
+
+	return C.ulonglong(id)
+}
+
+//export tea_emulator_free
+func tea_emulator_free(id C.ulonglong) {
+	emulatorsMu.Lock()
+	emulator := emulators[uint64(id)]
+	delete(emulators, uint64(id))
+	emulatorsMu.Unlock()
+
+	if emulator != nil {
+		emulator.Close()
+	}
+}
+
+//export tea_emulator_write
+func tea_emulator_write(id C.ulonglong, data *C.char, length C.int) {
+	emulator := getEmulator(uint64(id))
+
+	if emulator == nil {
+		return
+	}
+
+	emulator.Write([]byte(C.GoStringN(data, length)))
+}
+
+//export tea_emulator_send_input
+func tea_emulator_send_input(id C.ulonglong, data *C.char, length C.int) {
+	emulator := getEmulator(uint64(id))
+
+	if emulator == nil {
+		return
+	}
+
+	emulator.SendInput(C.GoStringN(data, length))
+}
+
+//export tea_emulator_resize
+func tea_emulator_resize(id C.ulonglong, width C.int, height C.int) {
+	emulator := getEmulator(uint64(id))
+
+	if emulator == nil {
+		return
+	}
+
+	emulator.Resize(int(width), int(height))
+}
+
+//export tea_emulator_screen_text
+func tea_emulator_screen_text(id C.ulonglong) *C.char {
+	emulator := getEmulator(uint64(id))
+
+	if emulator == nil {
+		return C.CString("")
+	}
+
+	return C.CString(emulator.Text())
+}
+
+//export tea_emulator_cell_at
+func tea_emulator_cell_at(id C.ulonglong, x C.int, y C.int) *C.char {
+	emulator := getEmulator(uint64(id))
+
+	if emulator == nil {
+		return C.CString("")
+	}
+
+	cell, ok := emulator.CellAt(int(x), int(y))
+
+	if !ok {
+		return C.CString("")
+	}
+
+	jsonBytes, _ := json.Marshal(cell)
+
+	return C.CString(string(jsonBytes))
+}
+
+//export tea_emulator_state
+func tea_emulator_state(id C.ulonglong) *C.char {
+	emulator := getEmulator(uint64(id))
+
+	if emulator == nil {
+		return C.CString("")
+	}
+
+	jsonBytes, _ := json.Marshal(emulator.State())
+
+	return C.CString(string(jsonBytes))
+}
+
+// tea_emulator_attach makes the emulator the program's terminal: output goes
+// to its screen and the input reader, when started afterwards, reads the
+// emulator's input. Like any input, it can't be swapped while it is read.
+//
+//export tea_emulator_attach
+func tea_emulator_attach(programID C.ulonglong, id C.ulonglong) C.int {
+	state := getProgram(uint64(programID))
+	emulator := getEmulator(uint64(id))
+
+	if state == nil || emulator == nil || state.inputBusy() {
+		return -1
+	}
+
+	state.setOutput(emulator)
+	state.setInput(emulator.inputReader, false)
+
+	width, height := emulator.Size()
+	state.resize(windowSize{width: width, height: height})
+
+	return 0
+}
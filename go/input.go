@@ -7,24 +7,43 @@ import "C"
 
 import (
 	"context"
+	"encoding/json"
+	"io"
 	"os"
+	"slices"
 	"sync"
 	"time"
 	"unsafe"
+	"github.com/charmbracelet/x/ansi"
 	"github.com/muesli/cancelreader"
 )
 
+// inputChunk is what the reader received: bytes read from the terminal, or
+// an already encoded event.
+type inputChunk struct {
+	data  []byte
+	event string
+}
+
 type InputReader struct {
 	cancelReader cancelreader.CancelReader
 	ctx          context.Context
 	cancel       context.CancelFunc
-	events       chan []byte
+	events       chan inputChunk
+	decoder      *InputDecoder
+	receiveMu    sync.Mutex
+	backlog      []string
 	mu           sync.Mutex
 	running      bool
+	done         chan struct{}
+	output       io.Writer
+	onResize     func(windowSize) bool
 }
 
-func NewInputReader() (*InputReader, error) {
-	reader, err := cancelreader.NewReader(os.Stdin)
+// NewInputReader reads events from input. Queries are written to output,
+// the program's terminal.
+func NewInputReader(escapeTimeout time.Duration, input *os.File, output io.Writer) (*InputReader, error) {
+	reader, err := cancelreader.NewReader(input)
 
 	if err != nil {
 		return nil, err
@@ -36,7 +55,9 @@ func NewInputReader() (*InputReader, error) {
 		cancelReader: reader,
 		ctx:          ctx,
 		cancel:       cancel,
-		events:       make(chan []byte, 100),
+		events:       make(chan inputChunk, 100),
+		decoder:      NewInputDecoder(escapeTimeout),
+		output:       output,
 	}, nil
 }
 
@@ -49,9 +70,10 @@ func (reader *InputReader) Start() {
 	}
 
 	reader.running = true
+	reader.done = make(chan struct{})
 	reader.mu.Unlock()
 
-	go reader.readLoop()
+	go reader.readLoop(reader.done)
 }
 
 func (reader *InputReader) Stop() {
@@ -64,11 +86,18 @@ func (reader *InputReader) Stop() {
 
 	reader.running = false
 	reader.cancel()
-	reader.cancelReader.Cancel()
+	// The read loop may still be inside Read, which must not see the input
+	// closed under it. A reader that can't be canceled may block for good.
+	if reader.cancelReader.Cancel() {
+		<-reader.done
+	}
+
 	reader.cancelReader.Close()
 }
 
-func (reader *InputReader) readLoop() {
+func (reader *InputReader) readLoop(done chan<- struct{}) {
+	defer close(done)
+
 	var buf [256]byte
 
 	for {
@@ -88,7 +117,7 @@ func (reader *InputReader) readLoop() {
 			copy(data, buf[:n])
 
 			select {
-			case reader.events <- data:
+			case reader.events <- inputChunk{data: data}:
 			case <-reader.ctx.Done():
 				return
 			}
@@ -96,6 +125,229 @@ func (reader *InputReader) readLoop() {
 	}
 }
 
+// PollEvents waits up to timeout for input and returns every event decoded
+// from it, starting with any left over from a Query. A partial sequence is
+// held in the decoder until the rest arrives or its escape timeout expires,
+// which may end the wait early.
+func (reader *InputReader) PollEvents(timeout time.Duration) []string {
+	reader.receiveMu.Lock()
+	defer reader.receiveMu.Unlock()
+
+	if len(reader.backlog) > 0 {
+		events := reader.backlog
+		reader.backlog = nil
+
+		return events
+	}
+
+	return reader.receive(time.Now().Add(timeout))
+}
+
+// Query writes request to the terminal and waits up to timeout for a reply
+// event of one of the given types. Any other events that arrive in the
+// meantime are kept for the next PollEvents.
+func (reader *InputReader) Query(request string, timeout time.Duration, eventTypes ...string) (string, bool) {
+	if slices.Contains(eventTypes, "cursor_position") {
+		reader.decoder.SetExpectCursorPosition(true)
+		defer reader.decoder.SetExpectCursorPosition(false)
+	}
+
+	reply := ""
+
+	reader.exchange(request, timeout, func(event string) (bool, bool) {
+		if !slices.Contains(eventTypes, eventType(event)) {
+			return false, false
+		}
+
+		reply = event
+
+		return true, true
+	})
+
+	return reply, reply != ""
+}
+
+// QueryMode asks the terminal for the state of a DEC private or ANSI mode and
+// waits for the report about that mode. Reports about other modes are kept
+// for the next PollEvents.
+func (reader *InputReader) QueryMode(mode int, private bool, timeout time.Duration) (int, bool) {
+	request := ansi.RequestMode(ansi.ANSIMode(mode))
+
+	if private {
+		request = ansi.RequestMode(ansi.DECMode(mode))
+	}
+
+	value, found := 0, false
+
+	reader.exchange(request, timeout, func(event string) (bool, bool) {
+		if eventType(event) != "mode_report" {
+			return false, false
+		}
+
+		var report ModeReportEvent
+		json.Unmarshal([]byte(event), &report)
+
+		if report.Mode != mode || report.Private != private {
+			return false, false
+		}
+
+		value, found = report.Value, true
+
+		return true, true
+	})
+
+	return value, found
+}
+
+// QueryUntil writes request to the terminal and collects every reply event
+// until one of type terminator arrives or timeout expires. Sending a primary
+// device attributes query last makes a reliable terminator, since every
+// terminal answers it and replies arrive in order.
+func (reader *InputReader) QueryUntil(request string, timeout time.Duration, terminator string) ([]string, bool) {
+	var replies []string
+
+	complete := false
+
+	reader.exchange(request, timeout, func(event string) (bool, bool) {
+		kind := eventType(event)
+
+		if !slices.Contains(replyEventTypes, kind) {
+			return false, false
+		}
+
+		replies = append(replies, event)
+		complete = kind == terminator
+
+		return true, complete
+	})
+
+	return replies, complete
+}
+
+// exchange writes request and passes each event received before the deadline
+// to handle, which reports whether it consumed the event and whether the
+// exchange is done. Unconsumed events are kept for the next PollEvents.
+func (reader *InputReader) exchange(request string, timeout time.Duration, handle func(event string) (bool, bool)) {
+	reader.receiveMu.Lock()
+	defer reader.receiveMu.Unlock()
+
+	io.WriteString(reader.output, request)
+
+	deadline := time.Now().Add(timeout)
+	done := false
+
+	for !done && time.Now().Before(deadline) {
+		for _, event := range reader.receive(deadline) {
+			if !done {
+				consumed, finished := handle(event)
+				done = finished
+
+				if consumed {
+					continue
+				}
+			}
+
+			reader.backlog = append(reader.backlog, event)
+		}
+	}
+}
+
+// receive waits until deadline for the next chunk of input, or for a partial
+// sequence to expire, and returns the events decoded from it.
+func (reader *InputReader) receive(deadline time.Time) []string {
+	for {
+		wait := time.Until(deadline)
+
+		if escapeDeadline, pending := reader.decoder.Deadline(); pending && escapeDeadline.Before(deadline) {
+			wait = time.Until(escapeDeadline)
+		}
+
+		timer := time.NewTimer(max(wait, 0))
+
+		select {
+		case chunk := <-reader.events:
+			timer.Stop()
+			events := reader.decode(chunk)
+
+			for drained := false; !drained; {
+				select {
+				case chunk := <-reader.events:
+					events = append(events, reader.decode(chunk)...)
+				default:
+					drained = true
+				}
+			}
+
+			if len(events) > 0 {
+				return events
+			}
+
+		case <-timer.C:
+			events := reader.decoder.Expire(time.Now())
+
+			if len(events) > 0 || !time.Now().Before(deadline) {
+				return events
+			}
+		}
+	}
+}
+
+// decode returns the events in a chunk of input.
+func (reader *InputReader) decode(chunk inputChunk) []string {
+	if chunk.event != "" {
+		return []string{chunk.event}
+	}
+
+	events := reader.decoder.Feed(chunk.data, time.Now())
+
+	return slices.DeleteFunc(events, func(event string) bool { return !reader.resizeReported(event) })
+}
+
+// ReadRaw waits up to timeout for input and copies the bytes read into
+// buffer, returning how many it copied; 0 when none arrived in time. Pushed
+// events have no raw bytes, so they are kept for the next PollEvents.
+func (reader *InputReader) ReadRaw(buffer []byte, timeout time.Duration) int {
+	deadline := time.After(timeout)
+
+	for {
+		select {
+		case chunk := <-reader.events:
+			if chunk.event != "" {
+				reader.receiveMu.Lock()
+				reader.backlog = append(reader.backlog, chunk.event)
+				reader.receiveMu.Unlock()
+
+				continue
+			}
+
+			return copy(buffer, chunk.data)
+
+		case <-deadline:
+			return 0
+		}
+	}
+}
+
+// Push queues an event that didn't come from the terminal's input, such as
+// a resize, behind the input read so far.
+func (reader *InputReader) Push(event string) {
+	select {
+	case reader.events <- inputChunk{event: event}:
+	case <-reader.ctx.Done():
+	}
+}
+
+// eventType returns the "type" field of a JSON encoded event.
+func eventType(jsonEvent string) string {
+	var event struct {
+		Type string `json:"type"`
+	}
+
+	json.Unmarshal([]byte(jsonEvent), &event)
+
+	return event.Type
+}
+
 //export tea_input_start_reader
 func tea_input_start_reader(programID C.ulonglong) C.int {
 	state := getProgram(uint64(programID))
@@ -107,13 +359,14 @@ func tea_input_start_reader(programID C.ulonglong) C.int {
 		return 0
 	}
 
-	reader, err := NewInputReader()
+	reader, err := NewInputReader(state.escapeTimeout, state.Input(), state.Writer())
 	if err != nil {
 		return -1
 	}
 
 	state.input = reader
 	reader.Start()
+	state.watchResize(reader)
 
 	return 0
 }
@@ -129,6 +382,20 @@ func tea_input_stop_reader(programID C.ulonglong) {
 	state.input = nil
 }
 
+//export tea_input_set_escape_timeout
+func tea_input_set_escape_timeout(programID C.ulonglong, timeoutMs C.int) {
+	state := getProgram(uint64(programID))
+	if state == nil {
+		return
+	}
+
+	state.escapeTimeout = time.Duration(timeoutMs) * time.Millisecond
+
+	if state.input != nil {
+		state.input.decoder.SetEscapeTimeout(state.escapeTimeout)
+	}
+}
+
 //export tea_input_read_raw
 func tea_input_read_raw(programID C.ulonglong, buffer *C.char, bufferSize C.int, timeoutMs C.int) C.int {
 	state := getProgram(uint64(programID))
@@ -137,22 +404,32 @@ func tea_input_read_raw(programID C.ulonglong, buffer *C.char, bufferSize C.int,
 		return -1
 	}
 
-	timeout := time.Duration(timeoutMs) * time.Millisecond
+	cBuffer := unsafe.Slice((*byte)(unsafe.Pointer(buffer)), int(bufferSize))
 
-	select {
-	case data := <-state.input.events:
-		copyLength := len(data)
+	return C.int(state.input.ReadRaw(cBuffer, time.Duration(timeoutMs)*time.Millisecond))
+}
 
-		if copyLength > int(bufferSize) {
-			copyLength = int(bufferSize)
-		}
+//export tea_input_poll_events
+func tea_input_poll_events(programID C.ulonglong, timeoutMs C.int) *C.char {
+	state := getProgram(uint64(programID))
+
+	if state == nil || state.input == nil {
+		return C.CString("")
+	}
 
-		cBuffer := (*[1 << 20]byte)(unsafe.Pointer(buffer))[:copyLength:copyLength]
-		copy(cBuffer, data[:copyLength])
+	events := state.input.PollEvents(time.Duration(timeoutMs) * time.Millisecond)
 
-		return C.int(copyLength)
+	if len(events) == 0 {
+		return C.CString("")
+	}
 
-	case <-time.After(timeout):
-		return 0
+	rawEvents := make([]json.RawMessage, len(events))
+
+	for i, event := range events {
+		rawEvents[i] = json.RawMessage(event)
 	}
+
+	jsonBytes, _ := json.Marshal(rawEvents)
+
+	return C.CString(string(jsonBytes))
 }
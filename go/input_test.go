@@ -0,0 +1,99 @@
+package main
+
+import (
+	"io"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newTestReader returns a running reader on a pipe and the pipe's write end.
+func newTestReader(t *testing.T) (*InputReader, *os.File) {
+	t.Helper()
+
+	input, output, err := os.Pipe()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := NewInputReader(DefaultEscapeTimeout, input, io.Discard)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader.Start()
+
+	t.Cleanup(func() {
+		reader.Stop()
+		output.Close()
+	})
+
+	return reader, output
+}
+
+func TestReadRawKeepsPushedEventsForPollEvents(t *testing.T) {
+	reader, output := newTestReader(t)
+	resize := `{"type":"resize","width":80,"height":24}`
+
+	reader.Push(resize)
+	output.WriteString("abc")
+
+	buffer := make([]byte, 16)
+	n := reader.ReadRaw(buffer, time.Second)
+
+	if got := string(buffer[:n]); got != "abc" {
+		t.Fatalf("ReadRaw() read %q, want %q", got, "abc")
+	}
+
+	if got := reader.PollEvents(10 * time.Millisecond); !reflect.DeepEqual(got, []string{resize}) {
+		t.Errorf("PollEvents() = %v, want the pushed resize event", got)
+	}
+}
+
+func TestReadRawTimesOut(t *testing.T) {
+	reader, _ := newTestReader(t)
+
+	if n := reader.ReadRaw(make([]byte, 16), 10*time.Millisecond); n != 0 {
+		t.Errorf("ReadRaw() = %d, want 0", n)
+	}
+}
+
+func TestQueryModeWaitsForRequestedMode(t *testing.T) {
+	reader, output := newTestReader(t)
+
+	// A report for another mode and one for the ANSI mode with the same number
+	output.WriteString("\x1b[?2004;1$y\x1b[2026;2$y\x1b[?2026;4$y")
+
+	value, ok := reader.QueryMode(2026, true, time.Second)
+
+	if !ok || value != 4 {
+		t.Fatalf("QueryMode() = %d, %v, want 4, true", value, ok)
+	}
+
+	events := reader.PollEvents(10 * time.Millisecond)
+
+	if got, want := len(events), 2; got != want {
+		t.Fatalf("PollEvents() = %v, want %d mode reports", events, want)
+	}
+
+	for _, event := range events {
+		if eventType(event) != "mode_report" {
+			t.Errorf("PollEvents() event = %s, want a mode_report", event)
+		}
+	}
+}
+
+func TestQueryModeMatchesAnsiModes(t *testing.T) {
+	reader, output := newTestReader(t)
+
+	output.WriteString("\x1b[?4;1$y\x1b[4;2$y")
+
+	value, ok := reader.QueryMode(4, false, time.Second)
+
+	if !ok || value != 2 {
+		t.Fatalf("QueryMode() = %d, %v, want 2, true", value, ok)
+	}
+}
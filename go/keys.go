@@ -6,7 +6,9 @@ package main
 import "C"
 
 import (
+	"bytes"
 	"encoding/json"
+	"strings"
 	"unicode/utf8"
 	"unsafe"
 )
@@ -71,14 +73,66 @@ const (
 	KeyF12      KeyType = -23
 	KeyShiftTab KeyType = -24
 	KeySpace    KeyType = -25
+
+	// Only distinguishable from tab, enter and esc with the kitty keyboard protocol
+	KeyCtrlI           KeyType = -26
+	KeyCtrlM           KeyType = -27
+	KeyCtrlOpenBracket KeyType = -28
+
+	KeyF13 KeyType = -29
+	KeyF14 KeyType = -30
+	KeyF15 KeyType = -31
+	KeyF16 KeyType = -32
+	KeyF17 KeyType = -33
+	KeyF18 KeyType = -34
+	KeyF19 KeyType = -35
+	KeyF20 KeyType = -36
+	KeyF21 KeyType = -37
+	KeyF22 KeyType = -38
+	KeyF23 KeyType = -39
+	KeyF24 KeyType = -40
+)
+
+// Key event actions. Repeat and release are only reported by terminals using
+// the kitty keyboard protocol with event types enabled.
+const (
+	KeyPress   = 0
+	KeyRelease = 1
+	KeyRepeat  = 2
+)
+
+// Modifier bits as encoded (minus one) in kitty key sequences. Legacy xterm
+// sequences share shift, alt and ctrl but use ModXtermMeta for meta.
+const (
+	ModShift = 1 << iota
+	ModAlt
+	ModCtrl
+	ModSuper
+	ModHyper
+	ModMeta
+	ModCapsLock
+	ModNumLock
+
+	ModXtermMeta = ModSuper
 )
 
 type KeyEvent struct {
-	Type    string `json:"type"`     // "key"
-	KeyType int    `json:"key_type"` // KeyType value
-	Runes   []rune `json:"runes"`    // Characters for KeyRunes
-	Alt     bool   `json:"alt"`      // Alt modifier
-	Name    string `json:"name"`     // Human-readable name
+	Type       string `json:"type"`                  // "key"
+	KeyType    int    `json:"key_type"`              // KeyType value
+	Runes      []rune `json:"runes"`                 // Characters for KeyRunes
+	Alt        bool   `json:"alt"`                   // Alt modifier
+	Shift      bool   `json:"shift"`                 // Shift modifier
+	Ctrl       bool   `json:"ctrl"`                  // Ctrl modifier
+	Meta       bool   `json:"meta"`                  // Meta modifier
+	Super      bool   `json:"super,omitempty"`       // Super modifier (kitty)
+	Hyper      bool   `json:"hyper,omitempty"`       // Hyper modifier (kitty)
+	CapsLock   bool   `json:"caps_lock,omitempty"`   // Caps Lock active (kitty)
+	NumLock    bool   `json:"num_lock,omitempty"`    // Num Lock active (kitty)
+	Keypad     bool   `json:"keypad,omitempty"`      // Key is on the numeric keypad
+	Action     int    `json:"action"`                // 0=press, 1=release, 2=repeat
+	ShiftedKey rune   `json:"shifted_key,omitempty"` // Key with shift applied (kitty)
+	BaseKey    rune   `json:"base_key,omitempty"`    // Key on the standard US layout (kitty)
+	Name       string `json:"name"`                  // Human-readable name
 }
 
 type MouseEvent struct {
@@ -93,9 +147,13 @@ type MouseEvent struct {
 }
 
 type ResizeEvent struct {
-	Type   string `json:"type"` // "resize"
-	Width  int    `json:"width"`
-	Height int    `json:"height"`
+	Type        string `json:"type"` // "resize"
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	PixelWidth  int    `json:"pixel_width"`  // 0 when the terminal doesn't report it
+	PixelHeight int    `json:"pixel_height"` // 0 when the terminal doesn't report it
+	CellWidth   int    `json:"cell_width"`   // Pixel width of one cell
+	CellHeight  int    `json:"cell_height"`  // Pixel height of one cell
 }
 
 type FocusEvent struct {
@@ -103,6 +161,16 @@ type FocusEvent struct {
 	Focus bool   `json:"focus"` // true for focus, false for blur
 }
 
+type PasteEvent struct {
+	Type    string `json:"type"`    // "paste"
+	Content string `json:"content"` // Text between the bracketed paste markers
+}
+
+const (
+	pasteStart = "\x1b[200~"
+	pasteEnd   = "\x1b[201~"
+)
+
 var keyNames = map[KeyType]string{
 	KeyNull:      "ctrl+@",
 	KeyCtrlA:     "ctrl+a",
@@ -158,45 +226,135 @@ var keyNames = map[KeyType]string{
 	KeyF12:       "f12",
 	KeyShiftTab:  "shift+tab",
 	KeySpace:     "space",
+
+	KeyCtrlI:           "ctrl+i",
+	KeyCtrlM:           "ctrl+m",
+	KeyCtrlOpenBracket: "ctrl+[",
+
+	KeyF13: "f13",
+	KeyF14: "f14",
+	KeyF15: "f15",
+	KeyF16: "f16",
+	KeyF17: "f17",
+	KeyF18: "f18",
+	KeyF19: "f19",
+	KeyF20: "f20",
+	KeyF21: "f21",
+	KeyF22: "f22",
+	KeyF23: "f23",
+	KeyF24: "f24",
 }
 
-var escapeSequences = map[string]KeyType{
-	"\x1b[A":     KeyUp,
-	"\x1b[B":     KeyDown,
-	"\x1b[C":     KeyRight,
-	"\x1b[D":     KeyLeft,
-	"\x1b[H":     KeyHome,
-	"\x1b[F":     KeyEnd,
-	"\x1b[1~":    KeyHome,
-	"\x1b[4~":    KeyEnd,
-	"\x1b[5~":    KeyPgUp,
-	"\x1b[6~":    KeyPgDown,
-	"\x1b[2~":    KeyInsert,
-	"\x1b[3~":    KeyDelete,
-	"\x1bOP":     KeyF1,
-	"\x1bOQ":     KeyF2,
-	"\x1bOR":     KeyF3,
-	"\x1bOS":     KeyF4,
-	"\x1b[15~":   KeyF5,
-	"\x1b[17~":   KeyF6,
-	"\x1b[18~":   KeyF7,
-	"\x1b[19~":   KeyF8,
-	"\x1b[20~":   KeyF9,
-	"\x1b[21~":   KeyF10,
-	"\x1b[23~":   KeyF11,
-	"\x1b[24~":   KeyF12,
-	"\x1b[Z":     KeyShiftTab,
-	"\x1b[1;2A":  KeyType(-100), // Shift+Up (placeholder)
-	"\x1b[1;2B":  KeyType(-101), // Shift+Down
-	"\x1b[1;2C":  KeyType(-102), // Shift+Right
-	"\x1b[1;2D":  KeyType(-103), // Shift+Left
-	"\x1b[1;5A":  KeyType(-104), // Ctrl+Up
-	"\x1b[1;5B":  KeyType(-105), // Ctrl+Down
-	"\x1b[1;5C":  KeyType(-106), // Ctrl+Right
-	"\x1b[1;5D":  KeyType(-107), // Ctrl+Left
+// ss3Keys maps the final byte of "ESC O <final>" sequences, sent for F1-F4
+// and for the cursor keys in application cursor mode (DECCKM).
+var ss3Keys = map[byte]KeyType{
+	'A': KeyUp,
+	'B': KeyDown,
+	'C': KeyRight,
+	'D': KeyLeft,
+	'H': KeyHome,
+	'F': KeyEnd,
+	'P': KeyF1,
+	'Q': KeyF2,
+	'R': KeyF3,
+	'S': KeyF4,
+	'M': KeyEnter, // keypad
+}
+
+// ss3KeypadRunes maps the keypad keys sent in application keypad mode (DECKPAM).
+var ss3KeypadRunes = map[byte]rune{
+	'X': '=',
+	'j': '*',
+	'k': '+',
+	'l': ',',
+	'm': '-',
+	'n': '.',
+	'o': '/',
+	'p': '0',
+	'q': '1',
+	'r': '2',
+	's': '3',
+	't': '4',
+	'u': '5',
+	'v': '6',
+	'w': '7',
+	'x': '8',
+	'y': '9',
+}
+
+// rxvtArrowKeys maps the lowercase finals rxvt uses for shift+arrow
+// ("ESC [ a") and ctrl+arrow ("ESC O a").
+var rxvtArrowKeys = map[byte]KeyType{
+	'a': KeyUp,
+	'b': KeyDown,
+	'c': KeyRight,
+	'd': KeyLeft,
+}
+
+// csiFinalKeys maps the final byte of "CSI 1 ; mod <final>" sequences.
+var csiFinalKeys = map[byte]KeyType{
+	'A': KeyUp,
+	'B': KeyDown,
+	'C': KeyRight,
+	'D': KeyLeft,
+	'H': KeyHome,
+	'F': KeyEnd,
+	'P': KeyF1,
+	'Q': KeyF2,
+	'R': KeyF3,
+	'S': KeyF4,
+	'Z': KeyShiftTab,
+}
+
+// csiTildeKeys maps the number of "CSI n ; mod ~" sequences.
+var csiTildeKeys = map[int]KeyType{
+	1:  KeyHome,
+	2:  KeyInsert,
+	3:  KeyDelete,
+	4:  KeyEnd,
+	5:  KeyPgUp,
+	6:  KeyPgDown,
+	7:  KeyHome,
+	8:  KeyEnd,
+	11: KeyF1,
+	12: KeyF2,
+	13: KeyF3,
+	14: KeyF4,
+	15: KeyF5,
+	17: KeyF6,
+	18: KeyF7,
+	19: KeyF8,
+	20: KeyF9,
+	21: KeyF10,
+	23: KeyF11,
+	24: KeyF12,
+	25: KeyF13,
+	26: KeyF14,
+	28: KeyF15,
+	29: KeyF16,
+	31: KeyF17,
+	32: KeyF18,
+	33: KeyF19,
+	34: KeyF20,
+}
+
+// rxvtFunctionKeys maps the rxvt encodings of F21-F24, which reuse the
+// shifted ("$") and ctrl ("^") forms of F11, F12, F1 and F2.
+var rxvtFunctionKeys = map[[2]int]KeyType{
+	{23, '$'}: KeyF21,
+	{24, '$'}: KeyF22,
+	{11, '^'}: KeyF23,
+	{12, '^'}: KeyF24,
 }
 
 func ParseInput(data []byte) (int, string) {
+	return parseInput(data, false)
+}
+
+// parseInput decodes the first event in data. A "CSI 1 ; n R" sequence is
+// ambiguous between a modified F3 and a cursor position report, and is only
+// read as the latter when preferCursorPosition is set.
+func parseInput(data []byte, preferCursorPosition bool) (int, string) {
 	if len(data) == 0 {
 		return 0, ""
 	}
@@ -220,6 +378,15 @@ func ParseInput(data []byte) (int, string) {
 		}
 	}
 
+	if bytes.HasPrefix(data, []byte(pasteStart)) {
+		return parsePaste(data)
+	}
+
+	// A paste end marker without a matching start is dropped
+	if bytes.HasPrefix(data, []byte(pasteEnd)) {
+		return len(pasteEnd), ""
+	}
+
 	// Check for mouse events (SGR format: ESC [ < ... M or m)
 	if len(data) >= 6 && data[0] == 0x1b && data[1] == '[' && data[2] == '<' {
 		consumed, mouseEvent := parseMouseSGR(data)
@@ -229,28 +396,71 @@ func ParseInput(data []byte) (int, string) {
 		}
 	}
 
-	if data[0] == 0x1b && len(data) > 1 {
-		for seq, keyType := range escapeSequences {
-			if len(data) >= len(seq) && string(data[:len(seq)]) == seq {
-				name := keyNames[keyType]
+	// Replies to terminal queries
+	if sequence, ok := parseCSI(data); ok {
+		if event, ok := parseReply(sequence, preferCursorPosition); ok {
+			jsonBytes, _ := json.Marshal(event)
+			return sequence.length, string(jsonBytes)
+		}
+	}
 
-				if name == "" {
-					name = "unknown"
-				}
+	if consumed, event, ok := parseOSC(data); ok {
+		if event == nil {
+			return consumed, ""
+		}
 
-				event := KeyEvent{
-					Type:    "key",
-					KeyType: int(keyType),
-					Runes:   nil,
-					Alt:     false,
-					Name:    name,
-				}
+		jsonBytes, _ := json.Marshal(event)
+		return consumed, string(jsonBytes)
+	}
 
-				jsonBytes, _ := json.Marshal(event)
+	if consumed, event, ok := parseDCS(data); ok {
+		if event == nil {
+			return consumed, ""
+		}
+
+		jsonBytes, _ := json.Marshal(event)
+		return consumed, string(jsonBytes)
+	}
+
+	// Kitty keyboard protocol: ESC [ code:shifted:base ; mods:action ; text u
+	if sequence, ok := parseCSI(data); ok && sequence.final == 'u' && sequence.marker == 0 {
+		jsonEvent := ""
+
+		if event, ok := parseKittyKey(sequence); ok {
+			jsonBytes, _ := json.Marshal(event)
+			jsonEvent = string(jsonBytes)
+		}
 
-				return len(seq), string(jsonBytes)
+		return sequence.length, jsonEvent
+	}
+
+	// Cursor and function keys, optionally with xterm modifiers
+	if sequence, ok := parseCSI(data); ok && sequence.marker == 0 {
+		if event, ok := parseCSIKey(sequence); ok {
+			jsonBytes, _ := json.Marshal(event)
+			return sequence.length, string(jsonBytes)
+		}
+	}
+
+	// Alt + cursor or function key (ESC followed by the key's sequence)
+	if len(data) > 1 && data[0] == 0x1b && data[1] == 0x1b {
+		if sequence, ok := parseCSI(data[1:]); ok && sequence.marker == 0 {
+			if event, ok := parseCSIKey(sequence); ok {
+				event.Alt = true
+				event.Name = modifiedKeyName(strings.TrimPrefix(keyNames[KeyType(event.KeyType)], "shift+"), event, true)
+
+				jsonBytes, _ := json.Marshal(event)
+				return sequence.length + 1, string(jsonBytes)
 			}
 		}
+	}
+
+	if data[0] == 0x1b && len(data) > 1 {
+		if consumed, event, ok := parseSS3(data); ok {
+			jsonBytes, _ := json.Marshal(event)
+
+			return consumed, string(jsonBytes)
+		}
 
 		// Alt + key (ESC followed by a character)
 		if len(data) >= 2 && data[1] >= 32 && data[1] < 127 {
@@ -334,6 +544,127 @@ func ParseInput(data []byte) (int, string) {
 	return size, string(jsonBytes)
 }
 
+// ParseEvents decodes every event in data, in order, and returns them along
+// with the number of bytes consumed. Unless flush is set, trailing bytes that
+// form an incomplete sequence are left unconsumed for the caller to retry once
+// more input has arrived.
+func ParseEvents(data []byte, flush bool) ([]string, int) {
+	return parseEvents(data, flush, false)
+}
+
+func parseEvents(data []byte, flush bool, preferCursorPosition bool) ([]string, int) {
+	var events []string
+
+	offset := 0
+
+	for offset < len(data) {
+		if !flush && isIncompleteSequence(data[offset:]) {
+			break
+		}
+
+		consumed, jsonEvent := parseInput(data[offset:], preferCursorPosition)
+
+		if consumed <= 0 {
+			break
+		}
+
+		if jsonEvent != "" {
+			events = append(events, jsonEvent)
+		}
+
+		offset += consumed
+	}
+
+	return events, offset
+}
+
+// isIncompleteSequence reports whether data is the beginning of an escape
+// sequence or UTF-8 character whose remaining bytes have not arrived yet.
+func isIncompleteSequence(data []byte) bool {
+	if len(data) == 0 {
+		return false
+	}
+
+	if data[0] != 0x1b {
+		return data[0] >= 0x80 && !utf8.FullRune(data)
+	}
+
+	if len(data) == 1 {
+		return true
+	}
+
+	if bytes.HasPrefix(data, []byte(pasteStart)) {
+		return !bytes.Contains(data, []byte(pasteEnd))
+	}
+
+	switch data[1] {
+	case 'P':
+		// DCS: runs until the string terminator
+		return !bytes.Contains(data[2:], []byte(stringTerminator))
+	case ']':
+		// OSC: runs until BEL or the string terminator
+		return bytes.IndexByte(data[2:], 0x07) < 0 && !bytes.Contains(data[2:], []byte(stringTerminator))
+	case 0x1b:
+		// Alt-prefixed sequence
+		return isIncompleteSequence(data[1:])
+	case 'O':
+		// SS3: optional modifier digits before the final byte
+		for i := 2; i < len(data); i++ {
+			if data[i] < '0' || data[i] > '9' {
+				return false
+			}
+		}
+
+		return true
+	case '[':
+		// CSI: parameter and intermediate bytes until a final byte (0x40-0x7e)
+		for i := 2; i < len(data); i++ {
+			if data[i] >= 0x40 && data[i] <= 0x7e {
+				return false
+			}
+
+			// rxvt terminates shifted keys with "$" after a single parameter;
+			// a mode report ("Ps;Pm$y") may still be waiting for its final byte
+			if data[i] == '$' && i == len(data)-1 && (data[2] < '<' || data[2] > '?') && bytes.IndexByte(data[2:i], ';') < 0 {
+				return false
+			}
+
+			if data[i] < 0x20 || data[i] > 0x3f {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	return false
+}
+
+// parsePaste collects everything between the bracketed paste markers into a
+// single event. Without an end marker the rest of data is taken as the paste.
+func parsePaste(data []byte) (int, string) {
+	content := data[len(pasteStart):]
+	consumed := len(data)
+
+	if end := bytes.Index(content, []byte(pasteEnd)); end >= 0 {
+		content = content[:end]
+		consumed = len(pasteStart) + end + len(pasteEnd)
+	}
+
+	// Terminals send carriage returns for pasted newlines
+	text := strings.ReplaceAll(string(content), "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+
+	event := PasteEvent{
+		Type:    "paste",
+		Content: strings.ToValidUTF8(text, string(utf8.RuneError)),
+	}
+
+	jsonBytes, _ := json.Marshal(event)
+
+	return consumed, string(jsonBytes)
+}
+
 // parseMouseSGR parses SGR mouse format: ESC [ < Cb ; Cx ; Cy M/m
 func parseMouseSGR(data []byte) (int, MouseEvent) {
 	// Format: \x1b[<button;x;y(M|m)
@@ -398,6 +729,436 @@ func parseMouseSGR(data []byte) (int, MouseEvent) {
 	}
 }
 
+// csiSequence is a decoded ESC [ marker params intermediate final sequence.
+// Each parameter holds its colon separated sub-parameters, with -1 for values
+// that were left empty.
+type csiSequence struct {
+	marker       byte
+	params       [][]int
+	intermediate byte
+	final        byte
+	length       int
+}
+
+// param returns the sub-parameter at index, or fallback when it is missing.
+func (sequence csiSequence) param(index, subIndex, fallback int) int {
+	if index >= len(sequence.params) || subIndex >= len(sequence.params[index]) {
+		return fallback
+	}
+
+	if value := sequence.params[index][subIndex]; value >= 0 {
+		return value
+	}
+
+	return fallback
+}
+
+// parseCSI splits a complete CSI sequence at the start of data into its parts.
+func parseCSI(data []byte) (csiSequence, bool) {
+	if len(data) < 3 || data[0] != 0x1b || data[1] != '[' {
+		return csiSequence{}, false
+	}
+
+	sequence := csiSequence{}
+	index := 2
+
+	if data[index] >= '<' && data[index] <= '?' {
+		sequence.marker = data[index]
+		index++
+	}
+
+	paramsStart := index
+
+	for index < len(data) && data[index] >= '0' && data[index] <= ';' {
+		index++
+	}
+
+	params := string(data[paramsStart:index])
+
+	for index < len(data) && data[index] >= 0x20 && data[index] <= 0x2f {
+		// rxvt ends shifted keys with "$", which is otherwise an intermediate
+		if data[index] == '$' && sequence.marker == 0 && (index+1 >= len(data) || data[index+1] != 'y') {
+			break
+		}
+
+		sequence.intermediate = data[index]
+		index++
+	}
+
+	if index >= len(data) {
+		return csiSequence{}, false
+	}
+
+	if (data[index] < 0x40 || data[index] > 0x7e) && data[index] != '$' {
+		return csiSequence{}, false
+	}
+
+	sequence.final = data[index]
+	sequence.length = index + 1
+
+	if params != "" {
+		for _, param := range strings.Split(params, ";") {
+			var subParams []int
+
+			for _, subParam := range strings.Split(param, ":") {
+				value := -1
+
+				if subParam != "" {
+					value = 0
+
+					for _, digit := range subParam {
+						value = value*10 + int(digit-'0')
+					}
+				}
+
+				subParams = append(subParams, value)
+			}
+
+			sequence.params = append(sequence.params, subParams)
+		}
+	}
+
+	return sequence, true
+}
+
+var kittyKeyTypes = map[int]KeyType{
+	9:     KeyTab,
+	13:    KeyEnter,
+	27:    KeyEsc,
+	32:    KeySpace,
+	127:   KeyBackspace,
+	57376: KeyF13,
+	57377: KeyF14,
+	57378: KeyF15,
+	57379: KeyF16,
+	57380: KeyF17,
+	57381: KeyF18,
+	57382: KeyF19,
+	57383: KeyF20,
+	57384: KeyF21,
+	57385: KeyF22,
+	57386: KeyF23,
+	57387: KeyF24,
+	57414: KeyEnter, // keypad
+	57417: KeyLeft,
+	57418: KeyRight,
+	57419: KeyUp,
+	57420: KeyDown,
+	57421: KeyPgUp,
+	57422: KeyPgDown,
+	57423: KeyHome,
+	57424: KeyEnd,
+	57425: KeyInsert,
+	57426: KeyDelete,
+}
+
+// kittyKeypadRunes maps the kitty codes of the keypad digits and operators.
+var kittyKeypadRunes = map[int]rune{
+	57399: '0',
+	57400: '1',
+	57401: '2',
+	57402: '3',
+	57403: '4',
+	57404: '5',
+	57405: '6',
+	57406: '7',
+	57407: '8',
+	57408: '9',
+	57409: '.',
+	57410: '/',
+	57411: '*',
+	57412: '-',
+	57413: '+',
+	57415: '=',
+	57416: ',',
+}
+
+// Range of kitty codes for keys on the numeric keypad
+const (
+	kittyKeypadFirst = 57399
+	kittyKeypadLast  = 57426
+)
+
+// applyModifiers sets the modifier flags of event from an xterm/kitty
+// modifier parameter (bitmask plus one).
+func (event *KeyEvent) applyModifiers(modifiers int) {
+	if modifiers < 1 {
+		return
+	}
+
+	mask := modifiers - 1
+
+	event.Shift = mask&ModShift != 0
+	event.Alt = mask&ModAlt != 0
+	event.Ctrl = mask&ModCtrl != 0
+	event.Super = mask&ModSuper != 0
+	event.Hyper = mask&ModHyper != 0
+	event.Meta = mask&ModMeta != 0
+	event.CapsLock = mask&ModCapsLock != 0
+	event.NumLock = mask&ModNumLock != 0
+}
+
+// modifiedKeyName prefixes name with the active modifiers, e.g. "ctrl+shift+left".
+func modifiedKeyName(name string, event KeyEvent, includeShift bool) string {
+	var prefix strings.Builder
+
+	if event.Ctrl {
+		prefix.WriteString("ctrl+")
+	}
+
+	if event.Alt {
+		prefix.WriteString("alt+")
+	}
+
+	if event.Shift && includeShift {
+		prefix.WriteString("shift+")
+	}
+
+	if event.Meta {
+		prefix.WriteString("meta+")
+	}
+
+	if event.Hyper {
+		prefix.WriteString("hyper+")
+	}
+
+	if event.Super {
+		prefix.WriteString("super+")
+	}
+
+	return prefix.String() + name
+}
+
+// applyXtermModifiers sets the modifier flags of event from the modifier
+// parameter of a legacy xterm sequence.
+func (event *KeyEvent) applyXtermModifiers(modifiers int) {
+	if modifiers < 1 {
+		return
+	}
+
+	mask := modifiers - 1
+
+	event.Shift = mask&ModShift != 0
+	event.Alt = mask&ModAlt != 0
+	event.Ctrl = mask&ModCtrl != 0
+	event.Meta = mask&ModXtermMeta != 0
+}
+
+// parseSS3 decodes "ESC O [mod] <final>" sequences: F1-F4, the cursor keys
+// in application cursor mode (DECCKM), rxvt ctrl+arrows and the keypad in
+// application keypad mode (DECKPAM).
+func parseSS3(data []byte) (int, KeyEvent, bool) {
+	if len(data) < 3 || data[0] != 0x1b || data[1] != 'O' {
+		return 0, KeyEvent{}, false
+	}
+
+	index := 2
+	modifiers := 0
+
+	for index < len(data) && data[index] >= '0' && data[index] <= '9' {
+		modifiers = modifiers*10 + int(data[index]-'0')
+		index++
+	}
+
+	if index >= len(data) {
+		return 0, KeyEvent{}, false
+	}
+
+	final := data[index]
+	event := KeyEvent{Type: "key"}
+	event.applyXtermModifiers(modifiers)
+
+	var name string
+
+	if keyType, ok := ss3Keys[final]; ok {
+		event.KeyType = int(keyType)
+		event.Keypad = final == 'M'
+		name = keyNames[keyType]
+	} else if keyType, ok := rxvtArrowKeys[final]; ok {
+		event.KeyType = int(keyType)
+		event.Ctrl = true
+		name = keyNames[keyType]
+	} else if r, ok := ss3KeypadRunes[final]; ok {
+		event.KeyType = int(KeyRunes)
+		event.Runes = []rune{r}
+		event.Keypad = true
+		name = string(r)
+	} else {
+		return 0, KeyEvent{}, false
+	}
+
+	event.Name = modifiedKeyName(name, event, true)
+
+	return index + 1, event, true
+}
+
+// parseCSIKey decodes the "CSI 1 ; mod <final>" and "CSI n ; mod ~" forms
+// of cursor and function keys. A ":action" sub-parameter on the modifier, as
+// sent by kitty with event types enabled, is honoured as well.
+func parseCSIKey(sequence csiSequence) (KeyEvent, bool) {
+	if sequence.intermediate != 0 {
+		return KeyEvent{}, false
+	}
+
+	var keyType KeyType
+	var ok bool
+
+	event := KeyEvent{Type: "key"}
+	number := sequence.param(0, 0, 0)
+
+	switch sequence.final {
+	case '~':
+		keyType, ok = csiTildeKeys[number]
+	case '$', '^', '@':
+		// rxvt marks shift, ctrl and ctrl+shift with the final byte
+		if keyType, ok = rxvtFunctionKeys[[2]int{number, int(sequence.final)}]; ok {
+			break
+		}
+
+		keyType, ok = csiTildeKeys[number]
+		event.Shift = sequence.final != '^'
+		event.Ctrl = sequence.final != '$'
+	case 'a', 'b', 'c', 'd':
+		keyType, ok = rxvtArrowKeys[sequence.final]
+		event.Shift = true
+	default:
+		keyType, ok = csiFinalKeys[sequence.final]
+	}
+
+	if !ok {
+		return KeyEvent{}, false
+	}
+
+	event.KeyType = int(keyType)
+
+	if len(sequence.params) > 1 {
+		event.applyXtermModifiers(sequence.param(1, 0, 1))
+	}
+
+	// xterm sends F13-F24 as shift+F1-F12
+	if keyType <= KeyF1 && keyType >= KeyF12 && sequence.param(1, 0, 1) == ModShift+1 {
+		keyType = KeyF13 - (KeyF1 - keyType)
+		event.KeyType = int(keyType)
+		event.Shift = false
+	}
+
+	switch sequence.param(1, 1, 1) {
+	case 2:
+		event.Action = KeyRepeat
+	case 3:
+		event.Action = KeyRelease
+	}
+
+	if keyType == KeyShiftTab {
+		event.Shift = true
+	}
+
+	event.Name = modifiedKeyName(strings.TrimPrefix(keyNames[keyType], "shift+"), event, true)
+
+	return event, true
+}
+
+// parseKittyKey decodes a kitty keyboard protocol "CSI ... u" sequence. Keys
+// from the private use area without a KeyType (e.g. bare modifier presses)
+// are reported as not ok and dropped.
+func parseKittyKey(sequence csiSequence) (KeyEvent, bool) {
+	code := sequence.param(0, 0, 0)
+
+	event := KeyEvent{
+		Type:       "key",
+		ShiftedKey: rune(max(sequence.param(0, 1, 0), 0)),
+		BaseKey:    rune(max(sequence.param(0, 2, 0), 0)),
+	}
+
+	event.applyModifiers(sequence.param(1, 0, 1))
+	event.Keypad = code >= kittyKeypadFirst && code <= kittyKeypadLast
+
+	switch sequence.param(1, 1, 1) {
+	case 2:
+		event.Action = KeyRepeat
+	case 3:
+		event.Action = KeyRelease
+	}
+
+	if r, ok := kittyKeypadRunes[code]; ok {
+		event.KeyType = int(KeyRunes)
+		event.Runes = []rune{r}
+		event.Name = modifiedKeyName(string(r), event, true)
+
+		return event, true
+	}
+
+	if keyType, ok := kittyKeyTypes[code]; ok {
+		if keyType == KeyTab && event.Shift {
+			keyType = KeyShiftTab
+		}
+
+		event.KeyType = int(keyType)
+		event.Name = modifiedKeyName(strings.TrimPrefix(keyNames[keyType], "shift+"), event, true)
+
+		if keyType == KeySpace {
+			event.Runes = []rune{' '}
+		}
+
+		return event, true
+	}
+
+	if code >= 0xe000 && code <= 0xf8ff || !utf8.ValidRune(rune(code)) || code < 32 {
+		return event, false
+	}
+
+	key := rune(code)
+
+	if event.Ctrl && key >= 'a' && key <= 'z' {
+		switch key {
+		case 'i':
+			event.KeyType = int(KeyCtrlI)
+		case 'm':
+			event.KeyType = int(KeyCtrlM)
+		default:
+			event.KeyType = int(KeyCtrlA) + int(key-'a')
+		}
+
+		event.Name = modifiedKeyName(string(key), event, true)
+
+		return event, true
+	}
+
+	if event.Ctrl && key == '[' {
+		event.KeyType = int(KeyCtrlOpenBracket)
+		event.Name = modifiedKeyName("[", event, true)
+
+		return event, true
+	}
+
+	event.KeyType = int(KeyRunes)
+
+	// Prefer the associated text, then the shifted key, over the base code
+	switch {
+	case len(sequence.params) > 2:
+		for _, textCode := range sequence.params[2] {
+			if textCode > 0 {
+				event.Runes = append(event.Runes, rune(textCode))
+			}
+		}
+	case event.Shift && event.ShiftedKey != 0:
+		event.Runes = []rune{event.ShiftedKey}
+	case event.Shift && key >= 'a' && key <= 'z':
+		event.Runes = []rune{key - 'a' + 'A'}
+	}
+
+	if len(event.Runes) == 0 {
+		event.Runes = []rune{key}
+	}
+
+	// Shift is implied by the produced character, so it stays out of the name
+	shifted := len(event.Runes) == 1 && event.Runes[0] != key
+
+	event.Name = modifiedKeyName(string(event.Runes), event, !shifted)
+
+	return event, true
+}
+
 // parseInts parses semicolon-separated integers
 func parseInts(s string, vals ...*int) (int, error) {
 	count := 0
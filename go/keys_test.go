@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+func TestModifiedKeysSetFlags(t *testing.T) {
+	tests := []struct {
+		sequence               string
+		name                   string
+		shift, alt, ctrl, meta bool
+	}{
+		{"\x1b[1;2H", "shift+home", true, false, false, false},
+		{"\x1b[1;5F", "ctrl+end", false, false, true, false},
+		{"\x1b[1;3P", "alt+f1", false, true, false, false},
+		{"\x1bO2P", "shift+f1", true, false, false, false},
+		{"\x1b[15;6~", "ctrl+shift+f5", true, false, true, false},
+		{"\x1b[24;9~", "meta+f12", false, false, false, true},
+		{"\x1b[3;4~", "alt+shift+delete", true, true, false, false},
+		{"\x1b[1;16A", "ctrl+alt+shift+meta+up", true, true, true, true},
+	}
+
+	for _, test := range tests {
+		events := feedAll(t, test.sequence)
+
+		if len(events) != 1 {
+			t.Errorf("Feed(%q) = %v, want one event", test.sequence, events)
+			continue
+		}
+
+		event := events[0]
+
+		if got := event["name"]; got != test.name {
+			t.Errorf("Feed(%q) name = %v, want %q", test.sequence, got, test.name)
+		}
+
+		for flag, want := range map[string]bool{"shift": test.shift, "alt": test.alt, "ctrl": test.ctrl, "meta": test.meta} {
+			if got := event[flag]; got != want {
+				t.Errorf("Feed(%q) %s = %v, want %v", test.sequence, flag, got, want)
+			}
+		}
+	}
+}
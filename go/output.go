@@ -0,0 +1,265 @@
+package main
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+	"syscall"
+	"github.com/charmbracelet/x/term"
+)
+
+// OutputBuffer is an in-memory output that collects everything written to
+// it until the caller reads it back.
+type OutputBuffer struct {
+	mu   sync.Mutex
+	data bytes.Buffer
+}
+
+func (buffer *OutputBuffer) Write(data []byte) (int, error) {
+	buffer.mu.Lock()
+	defer buffer.mu.Unlock()
+
+	return buffer.data.Write(data)
+}
+
+// ColorProfile reports that the buffer keeps every color as written, so
+// captured frames hold the exact bytes a true color terminal would get.
+func (buffer *OutputBuffer) ColorProfile() string {
+	return ColorProfileTrueColor
+}
+
+// Drain returns the bytes written since the last Drain and empties the buffer.
+func (buffer *OutputBuffer) Drain() string {
+	buffer.mu.Lock()
+	defer buffer.mu.Unlock()
+
+	data := buffer.data.String()
+	buffer.data.Reset()
+
+	return data
+}
+
+// openFD wraps a caller-owned file descriptor. It is duplicated so that
+// closing (or garbage collecting) our file never closes the caller's.
+func openFD(fd int, name string) (*os.File, error) {
+	duplicate, err := syscall.Dup(fd)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return os.NewFile(uintptr(duplicate), name), nil
+}
+
+// closeOutput releases an output we opened; stdout and buffers are left alone.
+func closeOutput(output io.Writer) {
+	if file, ok := output.(*os.File); ok && file != os.Stdout && file != os.Stderr {
+		file.Close()
+	}
+}
+
+// Output returns where the program writes terminal sequences, stdout unless
+// the caller supplied an output.
+func (state *ProgramState) Output() io.Writer {
+	if state == nil || state.output == nil {
+		return os.Stdout
+	}
+
+	return state.output
+}
+
+// Input returns where the program reads input from: stdin, unless the caller
+// supplied an input, it was redirected to the controlling terminal or the
+// program is attached to an emulator.
+func (state *ProgramState) Input() *os.File {
+	if state == nil || state.inputFile == nil {
+		return os.Stdin
+	}
+
+	return state.inputFile
+}
+
+// outputFile returns the program's output when it is a file, for size and
+// TTY checks; in-memory outputs have neither.
+func (state *ProgramState) outputFile() (*os.File, bool) {
+	file, ok := state.Output().(*os.File)
+	return file, ok
+}
+
+// outputIsTerminal reports whether the program's output reaches something
+// that answers queries: a TTY or an attached emulator.
+func (state *ProgramState) outputIsTerminal() bool {
+	if _, emulated := state.Output().(*Emulator); emulated {
+		return true
+	}
+
+	file, ok := state.outputFile()
+
+	return ok && term.IsTerminal(file.Fd())
+}
+
+// setOutput changes the program's output. The terminal and input reader
+// write through the program's writer, which follows it.
+func (state *ProgramState) setOutput(output io.Writer) {
+	previous := state.output
+
+	if state.writer == nil {
+		state.writer = NewOutputWriter(output)
+	} else {
+		state.writer.setOutput(output)
+	}
+
+	state.output = output
+	state.redirected &^= RedirectedOutput
+
+	if previous != nil {
+		closeOutput(previous)
+	}
+}
+
+// Writer returns the serialized writer for the renderer's frames: its own
+// when it has its own output, otherwise its program's.
+func (renderer *Renderer) Writer() *OutputWriter {
+	if renderer.output != nil {
+		return renderer.writer
+	}
+
+	return renderer.program.Writer()
+}
+
+// device returns the output the renderer's frames end up on.
+func (renderer *Renderer) device() io.Writer {
+	if renderer.output != nil {
+		return renderer.output
+	}
+
+	return renderer.program.Output()
+}
+
+func (renderer *Renderer) setOutput(output io.Writer) {
+	renderer.mu.Lock()
+	defer renderer.mu.Unlock()
+
+	if renderer.output != nil {
+		closeOutput(renderer.output)
+	}
+
+	renderer.output = output
+	renderer.writer = NewOutputWriter(output)
+
+	// A new output has none of the previous frame on it
+	renderer.repaint()
+	renderer.linesRendered = 0
+	renderer.cursorPlaced = false
+}
+
+func drainOutput(output io.Writer) string {
+	if buffer, ok := output.(*OutputBuffer); ok {
+		return buffer.Drain()
+	}
+
+	return ""
+}
+
+// outputCString copies output to C and stores its length in lengthOut, since
+// frames can hold NUL bytes that would end a C string early.
+func outputCString(output string, lengthOut *C.int) *C.char {
+	*lengthOut = C.int(len(output))
+	return C.CString(output)
+}
+
+//export tea_program_set_output_fd
+func tea_program_set_output_fd(programID C.ulonglong, fd C.int) C.int {
+	state := getProgram(uint64(programID))
+
+	if state == nil {
+		return -1
+	}
+
+	file, err := openFD(int(fd), "output")
+
+	if err != nil {
+		return -1
+	}
+
+	state.setOutput(file)
+
+	return 0
+}
+
+//export tea_program_set_output_buffer
+func tea_program_set_output_buffer(programID C.ulonglong) C.int {
+	state := getProgram(uint64(programID))
+
+	if state == nil {
+		return -1
+	}
+
+	state.setOutput(&OutputBuffer{})
+
+	return 0
+}
+
+//export tea_program_read_output
+func tea_program_read_output(programID C.ulonglong, lengthOut *C.int) *C.char {
+	state := getProgram(uint64(programID))
+
+	if state == nil {
+		return outputCString("", lengthOut)
+	}
+
+	return outputCString(drainOutput(state.Output()), lengthOut)
+}
+
+//export tea_renderer_set_output_fd
+func tea_renderer_set_output_fd(id C.ulonglong, fd C.int) C.int {
+	renderer := getRenderer(uint64(id))
+
+	if renderer == nil {
+		return -1
+	}
+
+	file, err := openFD(int(fd), "output")
+
+	if err != nil {
+		return -1
+	}
+
+	renderer.setOutput(file)
+
+	return 0
+}
+
+//export tea_renderer_set_output_buffer
+func tea_renderer_set_output_buffer(id C.ulonglong) C.int {
+	renderer := getRenderer(uint64(id))
+
+	if renderer == nil {
+		return -1
+	}
+
+	renderer.setOutput(&OutputBuffer{})
+
+	return 0
+}
+
+//export tea_renderer_read_output
+func tea_renderer_read_output(id C.ulonglong, lengthOut *C.int) *C.char {
+	renderer := getRenderer(uint64(id))
+
+	if renderer == nil {
+		return outputCString("", lengthOut)
+	}
+
+	renderer.mu.Lock()
+	output := renderer.device()
+	renderer.mu.Unlock()
+
+	return outputCString(drainOutput(output), lengthOut)
+}
@@ -6,9 +6,11 @@ package main
 import "C"
 
 import (
+	"io"
 	"os"
 	"strings"
 	"sync"
+	"time"
 	"unsafe"
 	"github.com/charmbracelet/x/ansi"
 )
@@ -22,6 +24,28 @@ type Renderer struct {
 	height        int
 	altScreen     bool
 	cursorHidden  bool
+	colorProfile  string
+	mode          int
+	lastCells     [][]Cell
+	repeatChars   bool
+	synchronized  bool
+	view          string
+	queuedLines   []string
+	scrolls       []scrollHint
+	program       *ProgramState
+	cursor        *FrameCursor
+	cursorPlaced  bool
+	placedX       int
+	placedY       int
+	placedRow     int
+	cursorStyle   int
+	cursorColor   string
+	output        io.Writer
+	writer        *OutputWriter
+	paused        bool
+	ticker        *time.Ticker
+	stop          chan struct{}
+	stopped       chan struct{}
 }
 
 var (
@@ -36,19 +60,34 @@ func getRenderer(id uint64) *Renderer {
 }
 
 //export tea_renderer_new
-func tea_renderer_new(programID C.ulonglong) C.ulonglong {
-	renderer := &Renderer{}
+func tea_renderer_new(programID C.ulonglong, mode C.int) C.ulonglong {
+	state := getProgram(uint64(programID))
+
+	renderer := &Renderer{
+		colorProfile: programColorProfile(state),
+		mode:         int(mode),
+		repeatChars:  supportsRepeat(),
+		program:      state,
+	}
+
+	if capabilities := programCapabilities(state); capabilities != nil {
+		renderer.synchronized = capabilities.SynchronizedOutput
+	}
 
 	renderersMu.Lock()
 	id := getNextID()
 	renderers[id] = renderer
 	renderersMu.Unlock()
 
-	state := getProgram(uint64(programID))
-
+	// Assume the usual terminal size until the real one is known
 	if state != nil {
-		state.width = 80
-		state.height = 24
+		state.sizeMu.Lock()
+
+		if state.width == 0 && state.height == 0 {
+			state.width, state.height = 80, 24
+		}
+
+		state.sizeMu.Unlock()
 	}
 
 	return C.ulonglong(id)
@@ -57,8 +96,37 @@ func tea_renderer_new(programID C.ulonglong) C.ulonglong {
 //export tea_renderer_free
 func tea_renderer_free(id C.ulonglong) {
 	renderersMu.Lock()
+	renderer := renderers[uint64(id)]
 	delete(renderers, uint64(id))
 	renderersMu.Unlock()
+
+	if renderer != nil {
+		renderer.Stop()
+
+		if renderer.output != nil {
+			closeOutput(renderer.output)
+		}
+	}
+}
+
+// programCapabilities returns the program's detected capabilities, or nil
+// when they haven't been detected.
+func programCapabilities(state *ProgramState) *Capabilities {
+	if state == nil || state.terminal == nil {
+		return nil
+	}
+
+	return state.terminal.capabilities
+}
+
+// programColorProfile returns the color profile from the program's detected
+// capabilities, falling back to the environment.
+func programColorProfile(state *ProgramState) string {
+	if capabilities := programCapabilities(state); capabilities != nil {
+		return capabilities.ColorProfile
+	}
+
+	return detectColorProfile(strings.ToLower(os.Getenv("TERM_PROGRAM")), state.Output())
 }
 
 //export tea_renderer_set_size
@@ -70,9 +138,20 @@ func tea_renderer_set_size(id C.ulonglong, width C.int, height C.int) {
 	}
 
 	renderer.mu.Lock()
-	renderer.width = int(width)
-	renderer.height = int(height)
-	renderer.mu.Unlock()
+	defer renderer.mu.Unlock()
+
+	renderer.setSize(int(width), int(height))
+}
+
+// setSize changes the size frames are trimmed to. The caller must hold the
+// renderer's lock.
+func (renderer *Renderer) setSize(width, height int) {
+	if renderer.width != width || renderer.height != height {
+		renderer.repaint()
+	}
+
+	renderer.width = width
+	renderer.height = height
 }
 
 //export tea_renderer_set_alt_screen
@@ -83,10 +162,86 @@ func tea_renderer_set_alt_screen(id C.ulonglong, enabled C.int) {
 	}
 
 	renderer.mu.Lock()
+	defer renderer.mu.Unlock()
+
+	if renderer.altScreen != (enabled != 0) {
+		renderer.repaint()
+	}
+
 	renderer.altScreen = enabled != 0
+}
+
+//export tea_renderer_set_synchronized_output
+func tea_renderer_set_synchronized_output(id C.ulonglong, enabled C.int) {
+	renderer := getRenderer(uint64(id))
+
+	if renderer == nil {
+		return
+	}
+
+	renderer.mu.Lock()
+	renderer.synchronized = enabled != 0
 	renderer.mu.Unlock()
 }
 
+//export tea_renderer_get_synchronized_output
+func tea_renderer_get_synchronized_output(id C.ulonglong) C.int {
+	renderer := getRenderer(uint64(id))
+
+	if renderer == nil {
+		return 0
+	}
+
+	renderer.mu.Lock()
+	defer renderer.mu.Unlock()
+
+	if renderer.synchronized {
+		return 1
+	}
+
+	return 0
+}
+
+//export tea_renderer_set_color_profile
+func tea_renderer_set_color_profile(id C.ulonglong, profile *C.char) C.int {
+	renderer := getRenderer(uint64(id))
+
+	if renderer == nil {
+		return -1
+	}
+
+	profileString := C.GoString(profile)
+
+	if profileString == "" {
+		profileString = detectColorProfile(strings.ToLower(os.Getenv("TERM_PROGRAM")), renderer.device())
+	}
+
+	if !isColorProfile(profileString) {
+		return -1
+	}
+
+	renderer.mu.Lock()
+	renderer.colorProfile = profileString
+	renderer.repaint()
+	renderer.mu.Unlock()
+
+	return 0
+}
+
+//export tea_renderer_get_color_profile
+func tea_renderer_get_color_profile(id C.ulonglong) *C.char {
+	renderer := getRenderer(uint64(id))
+
+	if renderer == nil {
+		return C.CString("")
+	}
+
+	renderer.mu.Lock()
+	defer renderer.mu.Unlock()
+
+	return C.CString(renderer.colorProfile)
+}
+
 //export tea_renderer_render
 func tea_renderer_render(id C.ulonglong, view *C.char) {
 	renderer := getRenderer(uint64(id))
@@ -98,77 +253,203 @@ func tea_renderer_render(id C.ulonglong, view *C.char) {
 	renderer.mu.Lock()
 	defer renderer.mu.Unlock()
 
-	viewString := C.GoString(view)
+	renderer.view = C.GoString(view)
+
+	if renderer.ticker == nil {
+		renderer.paint()
+	}
+}
+
+// paint draws the latest view unless it is already on screen or the renderer
+// is paused. The caller must hold the renderer's lock.
+func (renderer *Renderer) paint() {
+	if renderer.paused {
+		return
+	}
 
-	if viewString == renderer.lastRender {
+	viewString := renderer.view
+
+	if viewString == renderer.lastRender && len(renderer.queuedLines) == 0 && len(renderer.scrolls) == 0 && !renderer.cursorChanged() {
 		return
 	}
 
-	var buffer strings.Builder
-	newLines := strings.Split(viewString, "\n")
+	scrollback := renderer.returnCursor() + renderer.flushQueuedLines() + renderer.applyScrolls()
+
+	newLines := strings.Split(ConvertColors(viewString, renderer.colorProfile), "\n")
 
 	if renderer.height > 0 && len(newLines) > renderer.height {
 		newLines = newLines[len(newLines)-renderer.height:]
 	}
 
-	if renderer.altScreen {
-		buffer.WriteString(ansi.CursorHomePosition)
+	for i, line := range newLines {
+		if renderer.width > 0 && ansi.StringWidth(line) > renderer.width {
+			newLines[i] = ansi.Truncate(line, renderer.width, "")
+		}
+	}
 
-		for i, line := range newLines {
-			if renderer.width > 0 && ansi.StringWidth(line) > renderer.width {
-				line = ansi.Truncate(line, renderer.width, "")
-			}
+	var output string
+
+	if renderer.mode == RendererModeCells {
+		output = renderer.diffCells(newLines)
+	} else {
+		output = renderer.diffLines(newLines)
+	}
+
+	renderer.lastRender = viewString
+	renderer.lastLines = newLines
+	renderer.linesRendered = len(newLines)
+
+	output = scrollback + output + renderer.placeCursor()
+
+	if output != "" && renderer.synchronized {
+		// Let the terminal paint the frame at once instead of as it arrives
+		output = ansi.SetSynchronizedOutputMode + output + ansi.ResetSynchronizedOutputMode
+	}
+
+	io.WriteString(renderer.Writer(), output)
+}
 
-			buffer.WriteString(line)
+// flushQueuedLines returns the output that replaces the inline frame with
+// the queued lines, leaving them in the scrollback, and marks the frame for a
+// full redraw below them.
+func (renderer *Renderer) flushQueuedLines() string {
+	if len(renderer.queuedLines) == 0 {
+		return ""
+	}
+
+	var buffer strings.Builder
+
+	if renderer.linesRendered > 1 {
+		buffer.WriteString(ansi.CursorUp(renderer.linesRendered - 1))
+	}
+
+	buffer.WriteString("\r")
+
+	for _, line := range renderer.queuedLines {
+		buffer.WriteString(ConvertColors(line, renderer.colorProfile))
+
+		// A full-width line leaves the cursor on its last column, as in diffLines
+		if renderer.width <= 0 || ansi.StringWidth(line) < renderer.width {
 			buffer.WriteString(ansi.EraseLine(0))
+		}
 
-			if i < len(newLines) - 1 {
-				buffer.WriteString("\r\n")
-			}
+		buffer.WriteString("\r\n")
+	}
+
+	// Clear what is left of the old frame; it is redrawn from scratch
+	buffer.WriteString(ansi.EraseScreenBelow)
+
+	renderer.queuedLines = nil
+	renderer.lastLines = nil
+	renderer.lastCells = nil
+	renderer.linesRendered = 0
+
+	return buffer.String()
+}
+
+// Println queues text to be printed above the inline frame on the next
+// paint, where it stays in the terminal's scrollback. It does nothing in the
+// alternate screen, which has no scrollback.
+func (renderer *Renderer) Println(text string) {
+	renderer.mu.Lock()
+	defer renderer.mu.Unlock()
+
+	if renderer.altScreen {
+		return
+	}
+
+	renderer.queuedLines = append(renderer.queuedLines, strings.Split(text, "\n")...)
+
+	if renderer.ticker == nil {
+		renderer.paint()
+	}
+}
+
+// diffLines returns the output that turns the previous frame into lines,
+// writing only the lines that differ from lastLines. The cursor starts and
+// ends at the beginning of the frame's last line.
+func (renderer *Renderer) diffLines(lines []string) string {
+	var buffer strings.Builder
+
+	cursor := max(renderer.linesRendered-1, 0)
+
+	// moveTo puts the cursor at the start of line row of the frame. Inline
+	// frames can only grow downwards by emitting newlines.
+	moveTo := func(row int) {
+		if renderer.altScreen {
+			buffer.WriteString(ansi.CursorPosition(1, row+1))
+			cursor = row
+			return
 		}
 
-		if len(newLines) < renderer.linesRendered {
-			for i := len(newLines); i < renderer.linesRendered; i++ {
+		switch {
+		case row < cursor:
+			buffer.WriteString(ansi.CursorUp(cursor - row))
+		case row > cursor:
+			existing := max(min(row, renderer.linesRendered-1)-cursor, 0)
+
+			if existing > 0 {
+				buffer.WriteString(ansi.CursorDown(existing))
+			}
+
+			for i := cursor + existing; i < row; i++ {
 				buffer.WriteString("\r\n")
-				buffer.WriteString(ansi.EraseLine(2))
 			}
-		}
-	} else {
-		if renderer.linesRendered > 1 {
-			buffer.WriteString(ansi.CursorUp(renderer.linesRendered - 1))
-		}
-		buffer.WriteString("\r")
 
-		for i, line := range newLines {
-			if renderer.width > 0 && ansi.StringWidth(line) > renderer.width {
-				line = ansi.Truncate(line, renderer.width, "")
+			if cursor+existing < row {
+				cursor = row
+				return
 			}
+		}
 
-			buffer.WriteString(line)
-			buffer.WriteString(ansi.EraseLine(0))
+		buffer.WriteString("\r")
+		cursor = row
+	}
 
-			if i < len(newLines) - 1 {
-				buffer.WriteString("\r\n")
-			}
+	for i, line := range lines {
+		if i < len(renderer.lastLines) && renderer.lastLines[i] == line {
+			continue
 		}
 
-		if len(newLines) < renderer.linesRendered {
-			for i := len(newLines); i < renderer.linesRendered; i++ {
-				buffer.WriteString("\r\n")
-				buffer.WriteString(ansi.EraseLine(2))
-			}
+		moveTo(i)
+		buffer.WriteString(line)
 
-			buffer.WriteString(ansi.CursorUp(renderer.linesRendered - len(newLines)))
+		// After a full-width line the cursor stays on the last column, which
+		// the erase would clear
+		if renderer.width <= 0 || ansi.StringWidth(line) < renderer.width {
+			buffer.WriteString(ansi.EraseLine(0))
 		}
+	}
 
-		buffer.WriteString("\r")
+	for i := len(lines); i < renderer.linesRendered; i++ {
+		moveTo(i)
+		buffer.WriteString(ansi.EraseLine(2))
 	}
 
-	os.Stdout.WriteString(buffer.String())
+	if !renderer.altScreen && buffer.Len() > 0 {
+		moveTo(len(lines) - 1)
+	}
 
-	renderer.lastRender = viewString
-	renderer.lastLines = newLines
-	renderer.linesRendered = len(newLines)
+	return buffer.String()
+}
+
+// repaint makes the next render redraw every line, e.g. after the terminal
+// reflowed the frame or switched screens.
+func (renderer *Renderer) repaint() {
+	renderer.lastRender = ""
+	renderer.lastLines = nil
+	renderer.lastCells = nil
+}
+
+//export tea_renderer_println
+func tea_renderer_println(id C.ulonglong, text *C.char) {
+	renderer := getRenderer(uint64(id))
+
+	if renderer == nil {
+		return
+	}
+
+	renderer.Println(C.GoString(text))
 }
 
 //export tea_renderer_clear
@@ -182,12 +463,11 @@ func tea_renderer_clear(id C.ulonglong) {
 	renderer.mu.Lock()
 	defer renderer.mu.Unlock()
 
-	os.Stdout.WriteString(ansi.EraseEntireScreen)
-	os.Stdout.WriteString(ansi.CursorHomePosition)
+	io.WriteString(renderer.Writer(), ansi.EraseEntireScreen+ansi.CursorHomePosition)
 
-	renderer.lastRender = ""
-	renderer.lastLines = nil
+	renderer.repaint()
 	renderer.linesRendered = 0
+	renderer.cursorPlaced = false
 }
 
 //export tea_string_width
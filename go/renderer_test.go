@@ -0,0 +1,120 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiffLinesDrawsFirstFrame(t *testing.T) {
+	renderer := &Renderer{}
+
+	got := renderer.diffLines([]string{"a", "b"})
+
+	if want := "\ra\x1b[K\r\nb\x1b[K\r"; got != want {
+		t.Errorf("diffLines() = %q, want %q", got, want)
+	}
+}
+
+func TestDiffLinesRewritesOnlyChangedLines(t *testing.T) {
+	renderer := &Renderer{lastLines: []string{"one", "two", "three"}, linesRendered: 3}
+
+	got := renderer.diffLines([]string{"one", "2", "three"})
+
+	if want := "\x1b[A\r2\x1b[K\x1b[B\r"; got != want {
+		t.Errorf("diffLines() = %q, want %q", got, want)
+	}
+}
+
+func TestDiffLinesClearsRemovedLines(t *testing.T) {
+	renderer := &Renderer{lastLines: []string{"a", "b", "c"}, linesRendered: 3}
+
+	got := renderer.diffLines([]string{"a"})
+
+	if want := "\x1b[A\r\x1b[2K\x1b[B\r\x1b[2K\x1b[2A\r"; got != want {
+		t.Errorf("diffLines() = %q, want %q", got, want)
+	}
+}
+
+func TestDiffLinesSkipsUnchangedFrame(t *testing.T) {
+	renderer := &Renderer{lastLines: []string{"a", "b"}, linesRendered: 2}
+
+	if got := renderer.diffLines([]string{"a", "b"}); got != "" {
+		t.Errorf("diffLines() = %q, want no output", got)
+	}
+}
+
+func TestDiffLinesPositionsAbsolutelyInAltScreen(t *testing.T) {
+	renderer := &Renderer{lastLines: []string{"a", "b"}, linesRendered: 2, altScreen: true}
+
+	got := renderer.diffLines([]string{"a", "c"})
+
+	if want := "\x1b[2;1Hc\x1b[K"; got != want {
+		t.Errorf("diffLines() = %q, want %q", got, want)
+	}
+}
+
+func TestDiffLinesKeepsLastColumnOfFullWidthLine(t *testing.T) {
+	renderer := &Renderer{width: 4}
+
+	got := renderer.diffLines([]string{"abcd", "ab"})
+
+	if want := "\rabcd\r\nab\x1b[K\r"; got != want {
+		t.Errorf("diffLines() = %q, want %q", got, want)
+	}
+}
+
+// newBufferedRenderer returns a line renderer of the given size that writes
+// its frames to the returned buffer.
+func newBufferedRenderer(width, height int) (*Renderer, *OutputBuffer) {
+	buffer := &OutputBuffer{}
+	renderer := &Renderer{width: width, height: height, colorProfile: ColorProfileTrueColor}
+	renderer.setOutput(buffer)
+
+	return renderer, buffer
+}
+
+func TestPaintWrapsFrameInSynchronizedOutputWhenEnabled(t *testing.T) {
+	renderer, buffer := newBufferedRenderer(10, 5)
+
+	renderer.view = "a"
+	renderer.paint()
+
+	if got := buffer.Drain(); strings.Contains(got, "?2026") {
+		t.Errorf("paint() without synchronized output = %q, want no mode 2026", got)
+	}
+
+	renderer.synchronized = true
+	renderer.view = "b"
+	renderer.paint()
+
+	if got, want := buffer.Drain(), "\x1b[?2026h\rb\x1b[K\r\x1b[?2026l"; got != want {
+		t.Errorf("paint() with synchronized output = %q, want %q", got, want)
+	}
+
+	renderer.paint()
+
+	if got := buffer.Drain(); got != "" {
+		t.Errorf("paint() of an unchanged frame = %q, want no output", got)
+	}
+}
+
+func TestPrintlnKeepsFullWidthLinesAboveInlineFrame(t *testing.T) {
+	emulator, err := NewEmulator(9, 4)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	renderer := &Renderer{width: 9, height: 4, colorProfile: ColorProfileTrueColor}
+	renderer.setOutput(emulator)
+
+	renderer.view = "frame"
+	renderer.paint()
+
+	renderer.queuedLines = append(renderer.queuedLines, "short", "    aa aa")
+	renderer.paint()
+
+	if got, want := emulator.Text(), "short\n    aa aa\nframe"; got != want {
+		t.Errorf("screen = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+type CursorPositionEvent struct {
+	Type string `json:"type"` // "cursor_position"
+	X    int    `json:"x"`    // Column (0-based)
+	Y    int    `json:"y"`    // Row (0-based)
+}
+
+type DeviceAttributesEvent struct {
+	Type       string `json:"type"`       // "primary_device_attributes" or "secondary_device_attributes"
+	Attributes []int  `json:"attributes"` // Reported attribute parameters
+}
+
+type TerminalVersionEvent struct {
+	Type    string `json:"type"`    // "terminal_version"
+	Version string `json:"version"` // XTVERSION text, e.g. "kitty(0.31.0)"
+}
+
+type ModeReportEvent struct {
+	Type    string `json:"type"`    // "mode_report"
+	Mode    int    `json:"mode"`    // Mode number
+	Private bool   `json:"private"` // DEC private mode (CSI ? ... $ y)
+	Value   int    `json:"value"`   // 0=not recognized, 1=set, 2=reset, 3=permanently set, 4=permanently reset
+}
+
+type KittyKeyboardEvent struct {
+	Type  string `json:"type"`  // "kitty_keyboard"
+	Flags int    `json:"flags"` // Active progressive enhancement flags
+}
+
+type ColorEvent struct {
+	Type  string `json:"type"`  // "foreground_color", "background_color" or "cursor_color"
+	Color string `json:"color"` // Hex color, e.g. "#1e1e2e"
+	Dark  bool   `json:"dark"`  // Color is dark (HSL lightness below 0.5)
+}
+
+const stringTerminator = "\x1b\\"
+
+// replyEventTypes lists the events that are only sent in reply to a query.
+var replyEventTypes = []string{
+	"cursor_position",
+	"primary_device_attributes",
+	"secondary_device_attributes",
+	"terminal_version",
+	"mode_report",
+	"kitty_keyboard",
+	"foreground_color",
+	"background_color",
+	"cursor_color",
+}
+
+// oscColorTypes maps the OSC numbers of dynamic color replies to event types.
+var oscColorTypes = map[string]string{
+	"10": "foreground_color",
+	"11": "background_color",
+	"12": "cursor_color",
+}
+
+// parseReply decodes a CSI sequence sent by the terminal in reply to a query.
+func parseReply(sequence csiSequence, preferCursorPosition bool) (any, bool) {
+	switch {
+	case sequence.final == 'R' && sequence.intermediate == 0 && len(sequence.params) >= 2:
+		row := sequence.param(0, 0, 1)
+		column := sequence.param(1, 0, 1)
+
+		// "CSI 1 ; mod R" is also shift/ctrl/alt+F3
+		if sequence.marker == 0 && !preferCursorPosition && row == 1 && column <= 16 {
+			return nil, false
+		}
+
+		if sequence.marker != 0 && sequence.marker != '?' {
+			return nil, false
+		}
+
+		return CursorPositionEvent{Type: "cursor_position", X: column - 1, Y: row - 1}, true
+
+	case sequence.final == 'c' && (sequence.marker == '?' || sequence.marker == '>'):
+		event := DeviceAttributesEvent{Type: "primary_device_attributes", Attributes: []int{}}
+
+		if sequence.marker == '>' {
+			event.Type = "secondary_device_attributes"
+		}
+
+		for index := range sequence.params {
+			event.Attributes = append(event.Attributes, sequence.param(index, 0, 0))
+		}
+
+		return event, true
+
+	case sequence.final == 'y' && sequence.intermediate == '$' && (sequence.marker == 0 || sequence.marker == '?'):
+		return ModeReportEvent{
+			Type:    "mode_report",
+			Mode:    sequence.param(0, 0, 0),
+			Private: sequence.marker == '?',
+			Value:   sequence.param(1, 0, 0),
+		}, true
+
+	case sequence.final == 'u' && sequence.marker == '?':
+		return KittyKeyboardEvent{Type: "kitty_keyboard", Flags: sequence.param(0, 0, 0)}, true
+
+	case sequence.final == 't' && sequence.marker == 0 && sequence.intermediate == 0 && sequence.param(0, 0, 0) == 48:
+		return windowSize{
+			width:       sequence.param(2, 0, 0),
+			height:      sequence.param(1, 0, 0),
+			pixelWidth:  sequence.param(4, 0, 0),
+			pixelHeight: sequence.param(3, 0, 0),
+		}.event(), true
+	}
+
+	return nil, false
+}
+
+// parseDCS decodes a complete "ESC P ... ESC \" sequence. Only XTVERSION
+// replies produce an event; other device control strings are consumed and
+// dropped so they don't turn into keys.
+func parseDCS(data []byte) (int, any, bool) {
+	if len(data) < 2 || data[0] != 0x1b || data[1] != 'P' {
+		return 0, nil, false
+	}
+
+	end := bytes.Index(data[2:], []byte(stringTerminator))
+
+	if end < 0 {
+		return 0, nil, false
+	}
+
+	body := data[2 : 2+end]
+	consumed := 2 + end + len(stringTerminator)
+
+	if version, ok := bytes.CutPrefix(body, []byte(">|")); ok {
+		return consumed, TerminalVersionEvent{Type: "terminal_version", Version: string(version)}, true
+	}
+
+	return consumed, nil, true
+}
+
+// parseOSC decodes a complete "ESC ] ... BEL" or "ESC ] ... ESC \" sequence.
+// Only dynamic color replies produce an event; other operating system
+// commands are consumed and dropped.
+func parseOSC(data []byte) (int, any, bool) {
+	if len(data) < 2 || data[0] != 0x1b || data[1] != ']' {
+		return 0, nil, false
+	}
+
+	body := data[2:]
+	consumed := -1
+
+	if end := bytes.IndexByte(body, 0x07); end >= 0 {
+		body = body[:end]
+		consumed = 2 + end + 1
+	}
+
+	if end := bytes.Index(body, []byte(stringTerminator)); end >= 0 {
+		body = body[:end]
+		consumed = 2 + end + len(stringTerminator)
+	}
+
+	if consumed < 0 {
+		return 0, nil, false
+	}
+
+	number, value, _ := strings.Cut(string(body), ";")
+	kind, ok := oscColorTypes[number]
+
+	if !ok {
+		return consumed, nil, true
+	}
+
+	color, ok := parseXColor(value)
+
+	if !ok {
+		return consumed, nil, true
+	}
+
+	return consumed, ColorEvent{Type: kind, Color: color.Hex(), Dark: isDark(color)}, true
+}
+
+// parseXColor parses the X11 color specifications terminals reply with:
+// "rgb:R/G/B" or "rgba:R/G/B/A" with 1-4 hex digits per channel, or "#RRGGBB".
+func parseXColor(value string) (colorful.Color, bool) {
+	if strings.HasPrefix(value, "#") {
+		color, err := colorful.Hex(value)
+		return color, err == nil
+	}
+
+	spec, ok := strings.CutPrefix(value, "rgb:")
+
+	if !ok {
+		if spec, ok = strings.CutPrefix(value, "rgba:"); !ok {
+			return colorful.Color{}, false
+		}
+	}
+
+	parts := strings.Split(spec, "/")
+
+	if len(parts) < 3 {
+		return colorful.Color{}, false
+	}
+
+	var channels [3]float64
+
+	for index := range channels {
+		part := parts[index]
+
+		if len(part) == 0 || len(part) > 4 {
+			return colorful.Color{}, false
+		}
+
+		channel, err := strconv.ParseUint(part, 16, 16)
+
+		if err != nil {
+			return colorful.Color{}, false
+		}
+
+		channels[index] = float64(channel) / float64(uint64(1)<<(4*len(part))-1)
+	}
+
+	return colorful.Color{R: channels[0], G: channels[1], B: channels[2]}, true
+}
+
+func isDark(color colorful.Color) bool {
+	_, _, lightness := color.Hsl()
+	return lightness < 0.5
+}
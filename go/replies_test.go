@@ -0,0 +1,72 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseReplies(t *testing.T) {
+	tests := []struct {
+		sequence string
+		want     map[string]any
+	}{
+		{"\x1b[12;40R", map[string]any{"type": "cursor_position", "x": 39.0, "y": 11.0}},
+		{"\x1b[?62;22c", map[string]any{"type": "primary_device_attributes", "attributes": []any{62.0, 22.0}}},
+		{"\x1b[>1;10;0c", map[string]any{"type": "secondary_device_attributes", "attributes": []any{1.0, 10.0, 0.0}}},
+		{"\x1b[?2026;2$y", map[string]any{"type": "mode_report", "mode": 2026.0, "private": true, "value": 2.0}},
+		{"\x1b[4;1$y", map[string]any{"type": "mode_report", "mode": 4.0, "private": false, "value": 1.0}},
+		{"\x1bP>|kitty(0.31.0)\x1b\\", map[string]any{"type": "terminal_version", "version": "kitty(0.31.0)"}},
+	}
+
+	for _, test := range tests {
+		if got := feedAll(t, test.sequence); !reflect.DeepEqual(got, []map[string]any{test.want}) {
+			t.Errorf("Feed(%q) = %v, want %v", test.sequence, got, test.want)
+		}
+	}
+}
+
+func TestParseCursorPositionOnlyWhenExpected(t *testing.T) {
+	// "CSI 1 ; 5 R" is ctrl+F3 unless a cursor position query is outstanding
+	if got, want := names(feedAll(t, "\x1b[1;5R")), []string{"ctrl+f3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Feed() = %q, want %q", got, want)
+	}
+
+	decoder := NewInputDecoder(DefaultEscapeTimeout)
+	decoder.SetExpectCursorPosition(true)
+
+	events := decoder.Feed([]byte("\x1b[1;5R"), time.Now())
+
+	if len(events) != 1 || eventType(events[0]) != "cursor_position" {
+		t.Errorf("Feed() while expecting a cursor position = %q, want a cursor_position", events)
+	}
+}
+
+func TestParseBackgroundColorReply(t *testing.T) {
+	tests := []struct {
+		sequence string
+		color    string
+		dark     bool
+	}{
+		{"\x1b]11;rgb:1e1e/1e1e/2e2e\x1b\\", "#1e1e2e", true},
+		{"\x1b]11;rgb:ffff/ffff/ffff\x07", "#ffffff", false},
+		{"\x1b]11;rgb:fd/f6/e3\x1b\\", "#fdf6e3", false},
+	}
+
+	for _, test := range tests {
+		events := feedAll(t, test.sequence)
+
+		if len(events) != 1 || events[0]["type"] != "background_color" {
+			t.Errorf("Feed(%q) = %v, want a background_color", test.sequence, events)
+			continue
+		}
+
+		if got := events[0]["color"]; got != test.color {
+			t.Errorf("Feed(%q) color = %v, want %q", test.sequence, got, test.color)
+		}
+
+		if got := events[0]["dark"]; got != test.dark {
+			t.Errorf("Feed(%q) dark = %v, want %v", test.sequence, got, test.dark)
+		}
+	}
+}
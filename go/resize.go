@@ -0,0 +1,171 @@
+package main
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"encoding/json"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// inBandResizeMode makes the terminal report its size as "CSI 48 ; rows ;
+// cols ; ypix ; xpix t" whenever it changes, which reaches the program where
+// SIGWINCH can't, such as over a serial line.
+const inBandResizeMode = ansi.DECMode(2048)
+
+// windowSize is the size of the terminal in cells and, when the terminal
+// reports them, pixels.
+type windowSize struct {
+	width, height           int
+	pixelWidth, pixelHeight int
+}
+
+// event returns the resize event for size, with the size of one cell derived
+// from the pixel size.
+func (size windowSize) event() ResizeEvent {
+	event := ResizeEvent{
+		Type:        "resize",
+		Width:       size.width,
+		Height:      size.height,
+		PixelWidth:  size.pixelWidth,
+		PixelHeight: size.pixelHeight,
+	}
+
+	if size.width > 0 {
+		event.CellWidth = size.pixelWidth / size.width
+	}
+
+	if size.height > 0 {
+		event.CellHeight = size.pixelHeight / size.height
+	}
+
+	return event
+}
+
+// setSize records the terminal size and reports whether it changed. A size
+// without pixels, as many terminals leave them out of TIOCGWINSZ, keeps the
+// pixels reported in band for the same number of cells.
+func (state *ProgramState) setSize(size windowSize) bool {
+	state.sizeMu.Lock()
+	defer state.sizeMu.Unlock()
+
+	if state.width == size.width && state.height == size.height {
+		if size.pixelWidth == 0 && size.pixelHeight == 0 ||
+			state.pixelWidth == size.pixelWidth && state.pixelHeight == size.pixelHeight {
+			return false
+		}
+	}
+
+	state.width, state.height = size.width, size.height
+	state.pixelWidth, state.pixelHeight = size.pixelWidth, size.pixelHeight
+
+	return true
+}
+
+// watchResize handles SIGWINCH for as long as reader runs. Each resize
+// updates the program's size and renderers, and queues a resize event behind
+// the input that arrived before it. A resize missed while no reader ran, such
+// as while another process had the terminal, is queued first.
+func (state *ProgramState) watchResize(reader *InputReader) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGWINCH)
+
+	reader.onResize = state.resize
+
+	state.sizeMu.Lock()
+	known := state.width > 0 || state.height > 0
+	state.sizeMu.Unlock()
+
+	// Before the size is first known, the program asks for it itself
+	if size, ok := state.terminalSize(); ok && state.resize(size) && known {
+		event, _ := json.Marshal(size.event())
+		reader.Push(string(event))
+	}
+
+	go func() {
+		defer signal.Stop(signals)
+
+		for {
+			select {
+			case <-reader.ctx.Done():
+				return
+			case <-signals:
+				size, ok := state.terminalSize()
+
+				if ok && state.resize(size) {
+					event, _ := json.Marshal(size.event())
+					reader.Push(string(event))
+				}
+			}
+		}
+	}()
+}
+
+// resize updates the program's size and renderers, and reports whether the
+// size changed so the caller can drop the duplicate event when the signal
+// and the in-band report announce the same resize.
+func (state *ProgramState) resize(size windowSize) bool {
+	if !state.setSize(size) {
+		return false
+	}
+
+	renderersMu.RLock()
+
+	for _, renderer := range renderers {
+		if renderer.program == state {
+			renderer.mu.Lock()
+			renderer.setSize(size.width, size.height)
+			renderer.mu.Unlock()
+		}
+	}
+
+	renderersMu.RUnlock()
+
+	return true
+}
+
+// resizeReported handles an in-band size report decoded from input and
+// reports whether to pass its event on.
+func (reader *InputReader) resizeReported(jsonEvent string) bool {
+	if reader.onResize == nil || !strings.HasPrefix(jsonEvent, `{"type":"resize"`) {
+		return true
+	}
+
+	var event ResizeEvent
+
+	if err := json.Unmarshal([]byte(jsonEvent), &event); err != nil {
+		return true
+	}
+
+	return reader.onResize(windowSize{event.Width, event.Height, event.PixelWidth, event.PixelHeight})
+}
+
+//export tea_terminal_enable_in_band_resize
+func tea_terminal_enable_in_band_resize(programID C.ulonglong) {
+	state := getProgram(uint64(programID))
+
+	if state == nil || state.terminal == nil {
+		return
+	}
+
+	state.terminal.write(ansi.SetMode(inBandResizeMode))
+	state.terminal.inBandResize = true
+}
+
+//export tea_terminal_disable_in_band_resize
+func tea_terminal_disable_in_band_resize(programID C.ulonglong) {
+	state := getProgram(uint64(programID))
+
+	if state == nil || state.terminal == nil {
+		return
+	}
+
+	state.terminal.write(ansi.ResetMode(inBandResizeMode))
+	state.terminal.inBandResize = false
+}
@@ -0,0 +1,195 @@
+package main
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"io"
+	"time"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// DefaultFPS is the frame rate used when the caller passes a non-positive one.
+const DefaultFPS = 60
+
+// maxFPS caps the frame rate; faster than this, frames only cost bandwidth.
+const maxFPS = 120
+
+// Start paints the latest view on a ticker at fps frames per second. Until
+// Stop is called, Render calls only store the view, so updates between two
+// ticks collapse into a single frame.
+func (renderer *Renderer) Start(fps int) {
+	if fps <= 0 {
+		fps = DefaultFPS
+	}
+
+	fps = min(fps, maxFPS)
+
+	renderer.mu.Lock()
+	defer renderer.mu.Unlock()
+
+	if renderer.ticker != nil {
+		renderer.ticker.Reset(time.Second / time.Duration(fps))
+		return
+	}
+
+	renderer.ticker = time.NewTicker(time.Second / time.Duration(fps))
+	renderer.stop = make(chan struct{})
+	renderer.stopped = make(chan struct{})
+
+	go renderer.tickLoop(renderer.ticker, renderer.stop, renderer.stopped)
+}
+
+// Stop shuts the ticker down and paints the latest view, so the final frame
+// is on screen when Stop returns. The cursor goes back to the start of the
+// frame's last line with its default style and color.
+func (renderer *Renderer) Stop() {
+	renderer.mu.Lock()
+
+	if ticker := renderer.ticker; ticker != nil {
+		ticker.Stop()
+		renderer.ticker = nil
+		close(renderer.stop)
+		stopped := renderer.stopped
+
+		renderer.mu.Unlock()
+		<-stopped
+		renderer.mu.Lock()
+	}
+
+	defer renderer.mu.Unlock()
+
+	// A paused renderer has already handed the terminal over
+	if renderer.paused {
+		return
+	}
+
+	renderer.paint()
+	io.WriteString(renderer.Writer(), renderer.resetCursor())
+}
+
+// Pause paints the latest view and stops drawing until Resume, so another
+// process can use the terminal. The ticker keeps running but its frames are
+// skipped. Below an inline frame, the cursor is left on a fresh line.
+func (renderer *Renderer) Pause() {
+	renderer.mu.Lock()
+	defer renderer.mu.Unlock()
+
+	if renderer.paused {
+		return
+	}
+
+	renderer.paint()
+
+	output := renderer.resetCursor()
+
+	if !renderer.altScreen {
+		output += "\r\n"
+	}
+
+	io.WriteString(renderer.Writer(), output)
+
+	renderer.paused = true
+}
+
+// Resume draws the latest view from scratch, as whatever used the terminal
+// meanwhile left the screen unknown. An inline frame starts over at the
+// cursor; the alternate screen is cleared first.
+func (renderer *Renderer) Resume() {
+	renderer.mu.Lock()
+	defer renderer.mu.Unlock()
+
+	if !renderer.paused {
+		return
+	}
+
+	renderer.paused = false
+
+	if renderer.altScreen {
+		io.WriteString(renderer.Writer(), ansi.EraseEntireScreen+ansi.CursorHomePosition)
+	}
+
+	renderer.repaint()
+	renderer.linesRendered = 0
+	renderer.cursorPlaced = false
+
+	renderer.paint()
+}
+
+// Flush paints the latest view immediately.
+func (renderer *Renderer) Flush() {
+	renderer.mu.Lock()
+	defer renderer.mu.Unlock()
+
+	renderer.paint()
+}
+
+func (renderer *Renderer) tickLoop(ticker *time.Ticker, stop <-chan struct{}, stopped chan<- struct{}) {
+	defer close(stopped)
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			renderer.Flush()
+		}
+	}
+}
+
+//export tea_renderer_start
+func tea_renderer_start(id C.ulonglong, fps C.int) {
+	renderer := getRenderer(uint64(id))
+
+	if renderer == nil {
+		return
+	}
+
+	renderer.Start(int(fps))
+}
+
+//export tea_renderer_flush
+func tea_renderer_flush(id C.ulonglong) {
+	renderer := getRenderer(uint64(id))
+
+	if renderer == nil {
+		return
+	}
+
+	renderer.Flush()
+}
+
+//export tea_renderer_pause
+func tea_renderer_pause(id C.ulonglong) {
+	renderer := getRenderer(uint64(id))
+
+	if renderer == nil {
+		return
+	}
+
+	renderer.Pause()
+}
+
+//export tea_renderer_resume
+func tea_renderer_resume(id C.ulonglong) {
+	renderer := getRenderer(uint64(id))
+
+	if renderer == nil {
+		return
+	}
+
+	renderer.Resume()
+}
+
+//export tea_renderer_stop
+func tea_renderer_stop(id C.ulonglong) {
+	renderer := getRenderer(uint64(id))
+
+	if renderer == nil {
+		return
+	}
+
+	renderer.Stop()
+}
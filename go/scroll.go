@@ -0,0 +1,152 @@
+package main
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"strings"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// scrollHint tells the renderer that rows top to bottom of the frame
+// (inclusive) moved up by lines, or down when lines is negative, so the
+// terminal can shift them instead of having them redrawn.
+type scrollHint struct {
+	top, bottom, lines int
+}
+
+// Scroll queues a scroll hint for the next paint, which should draw the view
+// the scrolled content belongs to.
+func (renderer *Renderer) Scroll(top, bottom, lines int) {
+	renderer.scrolls = append(renderer.scrolls, scrollHint{top, bottom, lines})
+}
+
+// applyScrolls returns the output that shifts the frame on screen by the
+// queued scroll hints, and shifts the previous frame the same way so only
+// the newly exposed rows differ from it. In inline mode, the cursor starts
+// and ends at the beginning of the frame's last line.
+func (renderer *Renderer) applyScrolls() string {
+	hints := renderer.scrolls
+	renderer.scrolls = nil
+
+	// Nothing on screen to shift when the frame is redrawn from scratch
+	if renderer.mode == RendererModeCells && renderer.lastCells == nil ||
+		renderer.mode == RendererModeLines && renderer.lastLines == nil {
+		return ""
+	}
+
+	var buffer strings.Builder
+
+	last := renderer.linesRendered - 1
+
+	for _, hint := range hints {
+		top, bottom := max(hint.top, 0), min(hint.bottom, last)
+		n := min(max(hint.lines, -hint.lines), bottom-top+1)
+
+		if top >= bottom || n == 0 {
+			continue
+		}
+
+		if renderer.altScreen {
+			buffer.WriteString(ansi.SetTopBottomMargins(top+1, bottom+1))
+
+			if hint.lines > 0 {
+				buffer.WriteString(ansi.ScrollUp(n))
+			} else {
+				buffer.WriteString(ansi.ScrollDown(n))
+			}
+
+			buffer.WriteString(ansi.SetTopBottomMargins(0, 0))
+		} else {
+			// Deleting lines at one end of the region and inserting as many
+			// at the other leaves the rows outside it where they were
+			deleteAt, insertAt := top, bottom-n+1
+
+			if hint.lines < 0 {
+				deleteAt, insertAt = bottom-n+1, top
+			}
+
+			buffer.WriteString(moveRows(last, deleteAt))
+			buffer.WriteString(ansi.DeleteLine(n))
+			buffer.WriteString(moveRows(deleteAt, insertAt))
+			buffer.WriteString(ansi.InsertLine(n))
+			buffer.WriteString(moveRows(insertAt, last))
+		}
+
+		if hint.lines < 0 {
+			n = -n
+		}
+
+		renderer.shiftPrevious(top, bottom, n)
+	}
+
+	return buffer.String()
+}
+
+// moveRows returns the relative move from row from to row to.
+func moveRows(from, to int) string {
+	switch {
+	case to < from:
+		return ansi.CursorUp(from - to)
+	case to > from:
+		return ansi.CursorDown(to - from)
+	}
+
+	return ""
+}
+
+// shiftPrevious scrolls rows top to bottom of the previous frame by lines,
+// leaving blank rows where the terminal exposed them.
+func (renderer *Renderer) shiftPrevious(top, bottom, lines int) {
+	if renderer.mode == RendererModeCells {
+		cells := append([][]Cell(nil), renderer.lastCells...)
+		blank := make([]Cell, renderer.width)
+
+		for x := range blank {
+			blank[x] = blankCell
+		}
+
+		for y := top; y <= bottom && y < len(cells); y++ {
+			source := y + lines
+
+			if source < top || source > bottom || source >= len(renderer.lastCells) {
+				cells[y] = blank
+			} else {
+				cells[y] = renderer.lastCells[source]
+			}
+		}
+
+		renderer.lastCells = cells
+		return
+	}
+
+	previous := append([]string(nil), renderer.lastLines...)
+
+	for y := top; y <= bottom && y < len(previous); y++ {
+		source := y + lines
+
+		if source < top || source > bottom || source >= len(renderer.lastLines) {
+			previous[y] = ""
+		} else {
+			previous[y] = renderer.lastLines[source]
+		}
+	}
+
+	renderer.lastLines = previous
+}
+
+//export tea_renderer_scroll
+func tea_renderer_scroll(id C.ulonglong, top C.int, bottom C.int, lines C.int) {
+	renderer := getRenderer(uint64(id))
+
+	if renderer == nil {
+		return
+	}
+
+	renderer.mu.Lock()
+	defer renderer.mu.Unlock()
+
+	renderer.Scroll(int(top), int(bottom), int(lines))
+}
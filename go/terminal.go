@@ -6,19 +6,31 @@ package main
 import "C"
 
 import (
+	"encoding/json"
+	"io"
 	"os"
+	"strings"
+	"sync"
+	"time"
 	"github.com/charmbracelet/x/ansi"
 	"github.com/charmbracelet/x/term"
+	"golang.org/x/sys/unix"
 )
 
 type Terminal struct {
 	input         *os.File
-	output        *os.File
+	output        io.Writer
 	previousState *term.State
 	rawMode       bool
 	altScreen     bool
+	cursorMu      sync.Mutex
 	cursorHidden  bool
 	mouseEnabled  bool
+	kittyFlags    []int
+	cursorKeys    bool
+	keypad        bool
+	inBandResize  bool
+	capabilities  *Capabilities
 }
 
 //export tea_terminal_init
@@ -28,9 +40,11 @@ func tea_terminal_init(programID C.ulonglong) C.int {
 		return -1
 	}
 
+	state.useTTY()
+
 	state.terminal = &Terminal{
-		input:  os.Stdin,
-		output: os.Stdout,
+		input:  state.Input(),
+		output: state.Writer(),
 	}
 
 	return 0
@@ -44,9 +58,11 @@ func tea_terminal_enter_raw_mode(programID C.ulonglong) C.int {
 	}
 
 	if state.terminal == nil {
+		state.useTTY()
+
 		state.terminal = &Terminal{
-			input:  os.Stdin,
-			output: os.Stdout,
+			input:  state.Input(),
+			output: state.Writer(),
 		}
 	}
 
@@ -54,7 +70,13 @@ func tea_terminal_enter_raw_mode(programID C.ulonglong) C.int {
 		return 0
 	}
 
-	oldState, err := term.MakeRaw(os.Stdin.Fd())
+	// An emulator's input pipe has no line discipline to switch off
+	if state.inputFile != nil && !term.IsTerminal(state.inputFile.Fd()) {
+		state.terminal.rawMode = true
+		return 0
+	}
+
+	oldState, err := term.MakeRaw(state.terminal.input.Fd())
 	if err != nil {
 		return -1
 	}
@@ -77,7 +99,7 @@ func tea_terminal_exit_raw_mode(programID C.ulonglong) C.int {
 	}
 
 	if state.terminal.previousState != nil {
-		if err := term.Restore(os.Stdin.Fd(), state.terminal.previousState); err != nil {
+		if err := term.Restore(state.terminal.input.Fd(), state.terminal.previousState); err != nil {
 			return -1
 		}
 	}
@@ -86,9 +108,66 @@ func tea_terminal_exit_raw_mode(programID C.ulonglong) C.int {
 	return 0
 }
 
+// write sends sequences to the program's output as one operation, so they
+// can't be split by a frame or another thread's write.
+func (t *Terminal) write(sequences ...string) {
+	io.WriteString(t.output, strings.Join(sequences, ""))
+}
+
+// isCursorHidden reports whether the cursor was last hidden, by the program
+// or by a renderer's frame.
+func (t *Terminal) isCursorHidden() bool {
+	t.cursorMu.Lock()
+	defer t.cursorMu.Unlock()
+
+	return t.cursorHidden
+}
+
+// setCursorHidden records whether the cursor is hidden and reports whether
+// that changed. Renderers call it from their tickers, the program from its
+// own thread.
+func (t *Terminal) setCursorHidden(hidden bool) bool {
+	t.cursorMu.Lock()
+	defer t.cursorMu.Unlock()
+
+	if t.cursorHidden == hidden {
+		return false
+	}
+
+	t.cursorHidden = hidden
+
+	return true
+}
+
 func (t *Terminal) Restore() {
+	var sequences []string
+
+	if len(t.kittyFlags) > 0 {
+		sequences = append(sequences, ansi.PopKittyKeyboard(len(t.kittyFlags)))
+		t.kittyFlags = nil
+	}
+
+	if t.cursorKeys {
+		sequences = append(sequences, ansi.ResetCursorKeysMode)
+		t.cursorKeys = false
+	}
+
+	if t.keypad {
+		sequences = append(sequences, ansi.KeypadNumericMode)
+		t.keypad = false
+	}
+
+	if t.inBandResize {
+		sequences = append(sequences, ansi.ResetMode(inBandResizeMode))
+		t.inBandResize = false
+	}
+
+	if len(sequences) > 0 {
+		t.write(sequences...)
+	}
+
 	if t.previousState != nil {
-		term.Restore(os.Stdin.Fd(), t.previousState)
+		term.Restore(t.input.Fd(), t.previousState)
 	}
 }
 
@@ -104,9 +183,7 @@ func tea_terminal_enter_alt_screen(programID C.ulonglong) {
 		return
 	}
 
-	os.Stdout.WriteString(ansi.SetAltScreenBufferMode)
-	os.Stdout.WriteString(ansi.EraseEntireScreen)
-	os.Stdout.WriteString(ansi.CursorHomePosition)
+	state.terminal.write(ansi.SetAltScreenBufferMode, ansi.EraseEntireScreen, ansi.CursorHomePosition)
 
 	state.terminal.altScreen = true
 }
@@ -123,7 +200,7 @@ func tea_terminal_exit_alt_screen(programID C.ulonglong) {
 		return
 	}
 
-	os.Stdout.WriteString(ansi.ResetAltScreenBufferMode)
+	state.terminal.write(ansi.ResetAltScreenBufferMode)
 
 	state.terminal.altScreen = false
 }
@@ -135,12 +212,9 @@ func tea_terminal_hide_cursor(programID C.ulonglong) {
 		return
 	}
 
-	if state.terminal.cursorHidden {
-		return
+	if state.terminal.setCursorHidden(true) {
+		state.terminal.write(ansi.HideCursor)
 	}
-
-	os.Stdout.WriteString(ansi.HideCursor)
-	state.terminal.cursorHidden = true
 }
 
 //export tea_terminal_show_cursor
@@ -150,12 +224,9 @@ func tea_terminal_show_cursor(programID C.ulonglong) {
 		return
 	}
 
-	if !state.terminal.cursorHidden {
-		return
+	if state.terminal.setCursorHidden(false) {
+		state.terminal.write(ansi.ShowCursor)
 	}
-
-	os.Stdout.WriteString(ansi.ShowCursor)
-	state.terminal.cursorHidden = false
 }
 
 //export tea_terminal_enable_mouse_cell_motion
@@ -166,8 +237,7 @@ func tea_terminal_enable_mouse_cell_motion(programID C.ulonglong) {
 		return
 	}
 
-	os.Stdout.WriteString(ansi.SetButtonEventMouseMode)
-	os.Stdout.WriteString(ansi.SetSgrExtMouseMode)
+	state.terminal.write(ansi.SetButtonEventMouseMode, ansi.SetSgrExtMouseMode)
 
 	state.terminal.mouseEnabled = true
 }
@@ -180,8 +250,7 @@ func tea_terminal_enable_mouse_all_motion(programID C.ulonglong) {
 		return
 	}
 
-	os.Stdout.WriteString(ansi.SetAnyEventMouseMode)
-	os.Stdout.WriteString(ansi.SetSgrExtMouseMode)
+	state.terminal.write(ansi.SetAnyEventMouseMode, ansi.SetSgrExtMouseMode)
 
 	state.terminal.mouseEnabled = true
 }
@@ -198,80 +267,355 @@ func tea_terminal_disable_mouse(programID C.ulonglong) {
 		return
 	}
 
-	os.Stdout.WriteString(ansi.ResetButtonEventMouseMode)
-	os.Stdout.WriteString(ansi.ResetAnyEventMouseMode)
-	os.Stdout.WriteString(ansi.ResetSgrExtMouseMode)
+	state.terminal.write(ansi.ResetButtonEventMouseMode, ansi.ResetAnyEventMouseMode, ansi.ResetSgrExtMouseMode)
 
 	state.terminal.mouseEnabled = false
 }
 
 //export tea_terminal_enable_bracketed_paste
 func tea_terminal_enable_bracketed_paste(programID C.ulonglong) {
-	os.Stdout.WriteString(ansi.SetBracketedPasteMode)
+	state := getProgram(uint64(programID))
+
+	if state == nil || state.terminal == nil {
+		return
+	}
+
+	state.terminal.write(ansi.SetBracketedPasteMode)
 }
 
 //export tea_terminal_disable_bracketed_paste
 func tea_terminal_disable_bracketed_paste(programID C.ulonglong) {
-	os.Stdout.WriteString(ansi.ResetBracketedPasteMode)
+	state := getProgram(uint64(programID))
+
+	if state == nil || state.terminal == nil {
+		return
+	}
+
+	state.terminal.write(ansi.ResetBracketedPasteMode)
 }
 
 //export tea_terminal_enable_report_focus
 func tea_terminal_enable_report_focus(programID C.ulonglong) {
-	os.Stdout.WriteString(ansi.SetFocusEventMode)
+	state := getProgram(uint64(programID))
+
+	if state == nil || state.terminal == nil {
+		return
+	}
+
+	state.terminal.write(ansi.SetFocusEventMode)
 }
 
 //export tea_terminal_disable_report_focus
 func tea_terminal_disable_report_focus(programID C.ulonglong) {
-	os.Stdout.WriteString(ansi.ResetFocusEventMode)
+	state := getProgram(uint64(programID))
+
+	if state == nil || state.terminal == nil {
+		return
+	}
+
+	state.terminal.write(ansi.ResetFocusEventMode)
 }
 
-//export tea_terminal_get_size
-func tea_terminal_get_size(programID C.ulonglong, widthOut *C.int, heightOut *C.int) C.int {
-	w, h, err := term.GetSize(os.Stdout.Fd())
+//export tea_terminal_push_kitty_keyboard
+func tea_terminal_push_kitty_keyboard(programID C.ulonglong, flags C.int) {
+	state := getProgram(uint64(programID))
+
+	if state == nil || state.terminal == nil {
+		return
+	}
+
+	state.terminal.write(ansi.PushKittyKeyboard(int(flags)))
+
+	state.terminal.kittyFlags = append(state.terminal.kittyFlags, int(flags))
+}
+
+//export tea_terminal_pop_kitty_keyboard
+func tea_terminal_pop_kitty_keyboard(programID C.ulonglong) {
+	state := getProgram(uint64(programID))
+
+	if state == nil || state.terminal == nil {
+		return
+	}
+
+	if len(state.terminal.kittyFlags) == 0 {
+		return
+	}
+
+	state.terminal.write(ansi.PopKittyKeyboard(1))
+
+	state.terminal.kittyFlags = state.terminal.kittyFlags[:len(state.terminal.kittyFlags)-1]
+}
+
+//export tea_terminal_enable_application_cursor
+func tea_terminal_enable_application_cursor(programID C.ulonglong) {
+	state := getProgram(uint64(programID))
+
+	if state == nil || state.terminal == nil {
+		return
+	}
+
+	state.terminal.write(ansi.SetCursorKeysMode)
+
+	state.terminal.cursorKeys = true
+}
+
+//export tea_terminal_disable_application_cursor
+func tea_terminal_disable_application_cursor(programID C.ulonglong) {
+	state := getProgram(uint64(programID))
+
+	if state == nil || state.terminal == nil {
+		return
+	}
+
+	if !state.terminal.cursorKeys {
+		return
+	}
+
+	state.terminal.write(ansi.ResetCursorKeysMode)
+
+	state.terminal.cursorKeys = false
+}
+
+//export tea_terminal_enable_application_keypad
+func tea_terminal_enable_application_keypad(programID C.ulonglong) {
+	state := getProgram(uint64(programID))
+
+	if state == nil || state.terminal == nil {
+		return
+	}
+
+	state.terminal.write(ansi.KeypadApplicationMode)
+
+	state.terminal.keypad = true
+}
+
+//export tea_terminal_disable_application_keypad
+func tea_terminal_disable_application_keypad(programID C.ulonglong) {
+	state := getProgram(uint64(programID))
+
+	if state == nil || state.terminal == nil {
+		return
+	}
+
+	if !state.terminal.keypad {
+		return
+	}
+
+	state.terminal.write(ansi.KeypadNumericMode)
+
+	state.terminal.keypad = false
+}
+
+// terminalSize returns the size of the program's output: the emulator's
+// screen or the terminal's window, with the pixel size from TIOCGWINSZ.
+func (state *ProgramState) terminalSize() (windowSize, bool) {
+	if sizer, ok := state.Output().(interface{ Size() (int, int) }); ok {
+		width, height := sizer.Size()
+		return windowSize{width: width, height: height}, true
+	}
+
+	file, ok := state.outputFile()
+
+	if !ok {
+		return windowSize{}, false
+	}
+
+	winsize, err := unix.IoctlGetWinsize(int(file.Fd()), unix.TIOCGWINSZ)
 
 	if err != nil {
-		return -1
+		return windowSize{}, false
 	}
 
-	*widthOut = C.int(w)
-	*heightOut = C.int(h)
+	return windowSize{
+		width:       int(winsize.Col),
+		height:      int(winsize.Row),
+		pixelWidth:  int(winsize.Xpixel),
+		pixelHeight: int(winsize.Ypixel),
+	}, true
+}
 
+//export tea_terminal_get_size
+func tea_terminal_get_size(programID C.ulonglong, widthOut *C.int, heightOut *C.int, pixelWidthOut *C.int, pixelHeightOut *C.int) C.int {
 	state := getProgram(uint64(programID))
+	size, ok := state.terminalSize()
 
-	if state != nil {
-		state.width = w
-		state.height = h
+	if !ok {
+		return -1
 	}
 
+	*widthOut = C.int(size.width)
+	*heightOut = C.int(size.height)
+	*pixelWidthOut = C.int(size.pixelWidth)
+	*pixelHeightOut = C.int(size.pixelHeight)
+
 	return 0
 }
 
+// The functions below write to the program's output; a programID of 0 means
+// the process's own stdin and stdout.
+
+//export tea_terminal_write
+func tea_terminal_write(programID C.ulonglong, data *C.char, length C.int) {
+	io.WriteString(getProgram(uint64(programID)).Writer(), C.GoStringN(data, length))
+}
+
 //export tea_terminal_set_window_title
-func tea_terminal_set_window_title(title *C.char) {
-	os.Stdout.WriteString(ansi.SetWindowTitle(C.GoString(title)))
+func tea_terminal_set_window_title(programID C.ulonglong, title *C.char) {
+	io.WriteString(getProgram(uint64(programID)).Writer(), ansi.SetWindowTitle(C.GoString(title)))
 }
 
 //export tea_terminal_is_tty
-func tea_terminal_is_tty() C.int {
-	if term.IsTerminal(os.Stdin.Fd()) {
+func tea_terminal_is_tty(programID C.ulonglong) C.int {
+	if term.IsTerminal(getProgram(uint64(programID)).Input().Fd()) {
 		return 1
 	}
 
 	return 0
 }
 
+//export tea_terminal_output_is_tty
+func tea_terminal_output_is_tty(programID C.ulonglong) C.int {
+	state := getProgram(uint64(programID))
+
+	if state == nil || !state.outputIsTerminal() {
+		return 0
+	}
+
+	return 1
+}
+
 //export tea_terminal_clear_screen
-func tea_terminal_clear_screen() {
-	os.Stdout.WriteString(ansi.EraseEntireScreen)
-	os.Stdout.WriteString(ansi.CursorHomePosition)
+func tea_terminal_clear_screen(programID C.ulonglong) {
+	io.WriteString(getProgram(uint64(programID)).Writer(), ansi.EraseEntireScreen+ansi.CursorHomePosition)
 }
 
 //export tea_terminal_erase_line
-func tea_terminal_erase_line() {
-	os.Stdout.WriteString(ansi.EraseLine(2)) // 2 = erase entire line
+func tea_terminal_erase_line(programID C.ulonglong) {
+	io.WriteString(getProgram(uint64(programID)).Writer(), ansi.EraseLine(2)) // 2 = erase entire line
 }
 
 //export tea_terminal_cursor_home
-func tea_terminal_cursor_home() {
-	os.Stdout.WriteString(ansi.CursorHomePosition)
+func tea_terminal_cursor_home(programID C.ulonglong) {
+	io.WriteString(getProgram(uint64(programID)).Writer(), ansi.CursorHomePosition)
+}
+
+// queryTerminal sends request and waits for a reply of one of the given event
+// types through the program's input reader, which must be running.
+func queryTerminal(programID C.ulonglong, request string, timeoutMs C.int, eventTypes ...string) (string, bool) {
+	state := getProgram(uint64(programID))
+
+	if state == nil || state.input == nil {
+		return "", false
+	}
+
+	return state.input.Query(request, time.Duration(timeoutMs)*time.Millisecond, eventTypes...)
+}
+
+//export tea_terminal_query_cursor_position
+func tea_terminal_query_cursor_position(programID C.ulonglong, timeoutMs C.int, xOut *C.int, yOut *C.int) C.int {
+	reply, ok := queryTerminal(programID, ansi.RequestCursorPositionReport, timeoutMs, "cursor_position")
+
+	if !ok {
+		return -1
+	}
+
+	var event CursorPositionEvent
+	json.Unmarshal([]byte(reply), &event)
+
+	*xOut = C.int(event.X)
+	*yOut = C.int(event.Y)
+
+	return 0
+}
+
+//export tea_terminal_query_device_attributes
+func tea_terminal_query_device_attributes(programID C.ulonglong, timeoutMs C.int) *C.char {
+	reply, _ := queryTerminal(programID, ansi.RequestPrimaryDeviceAttributes, timeoutMs, "primary_device_attributes")
+	return C.CString(reply)
+}
+
+//export tea_terminal_query_secondary_device_attributes
+func tea_terminal_query_secondary_device_attributes(programID C.ulonglong, timeoutMs C.int) *C.char {
+	reply, _ := queryTerminal(programID, ansi.RequestSecondaryDeviceAttributes, timeoutMs, "secondary_device_attributes")
+	return C.CString(reply)
+}
+
+//export tea_terminal_query_version
+func tea_terminal_query_version(programID C.ulonglong, timeoutMs C.int) *C.char {
+	reply, ok := queryTerminal(programID, ansi.RequestNameVersion, timeoutMs, "terminal_version")
+
+	if !ok {
+		return C.CString("")
+	}
+
+	var event TerminalVersionEvent
+	json.Unmarshal([]byte(reply), &event)
+
+	return C.CString(event.Version)
+}
+
+//export tea_terminal_query_mode
+func tea_terminal_query_mode(programID C.ulonglong, mode C.int, private C.int, timeoutMs C.int) C.int {
+	state := getProgram(uint64(programID))
+
+	if state == nil || state.input == nil {
+		return -1
+	}
+
+	value, ok := state.input.QueryMode(int(mode), private != 0, time.Duration(timeoutMs)*time.Millisecond)
+
+	if !ok {
+		return -1
+	}
+
+	return C.int(value)
+}
+
+// queryColor sends an OSC color request and returns the decoded reply.
+func queryColor(programID C.ulonglong, request string, timeoutMs C.int, eventType string) (ColorEvent, bool) {
+	var event ColorEvent
+
+	reply, ok := queryTerminal(programID, request, timeoutMs, eventType)
+
+	if !ok {
+		return event, false
+	}
+
+	json.Unmarshal([]byte(reply), &event)
+
+	return event, true
+}
+
+// HasDarkBackground asks the terminal for its background color and reports
+// whether it is dark. The second value is false when the terminal did not answer.
+func HasDarkBackground(programID C.ulonglong, timeoutMs C.int) (bool, bool) {
+	event, ok := queryColor(programID, ansi.RequestBackgroundColor, timeoutMs, "background_color")
+	return event.Dark, ok
+}
+
+//export tea_terminal_query_background_color
+func tea_terminal_query_background_color(programID C.ulonglong, timeoutMs C.int) *C.char {
+	event, _ := queryColor(programID, ansi.RequestBackgroundColor, timeoutMs, "background_color")
+	return C.CString(event.Color)
+}
+
+//export tea_terminal_query_foreground_color
+func tea_terminal_query_foreground_color(programID C.ulonglong, timeoutMs C.int) *C.char {
+	event, _ := queryColor(programID, ansi.RequestForegroundColor, timeoutMs, "foreground_color")
+	return C.CString(event.Color)
+}
+
+//export tea_terminal_has_dark_background
+func tea_terminal_has_dark_background(programID C.ulonglong, timeoutMs C.int) C.int {
+	dark, ok := HasDarkBackground(programID, timeoutMs)
+
+	if !ok {
+		return -1
+	}
+
+	if dark {
+		return 1
+	}
+
+	return 0
 }
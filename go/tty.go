@@ -0,0 +1,132 @@
+package main
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"os"
+	"github.com/charmbracelet/x/term"
+)
+
+// ttyPath is the controlling terminal of the process, reachable even when
+// stdin and stdout are redirected.
+const ttyPath = "/dev/tty"
+
+// Streams that were redirected to the controlling terminal.
+const (
+	RedirectedInput  = 1
+	RedirectedOutput = 2
+)
+
+// useTTY opens the controlling terminal in place of stdin and stdout when
+// they aren't terminals, so a program can read piped data or have its stdout
+// captured and still be interactive. Streams the caller already replaced are
+// left alone, as is everything when there is no controlling terminal.
+func (state *ProgramState) useTTY() {
+	if state.inputFile == nil && !term.IsTerminal(os.Stdin.Fd()) {
+		if tty, err := os.OpenFile(ttyPath, os.O_RDONLY, 0); err == nil {
+			state.setInput(tty, true)
+			state.redirected |= RedirectedInput
+		}
+	}
+
+	if state.output == nil && !term.IsTerminal(os.Stdout.Fd()) {
+		if tty, err := os.OpenFile(ttyPath, os.O_WRONLY, 0); err == nil {
+			state.setOutput(tty)
+			state.redirected |= RedirectedOutput
+		}
+	}
+}
+
+// setInput changes where the program reads input from. When owned, the
+// program closes the input once it is replaced or freed.
+func (state *ProgramState) setInput(input *os.File, owned bool) {
+	if state.inputOwned {
+		state.inputFile.Close()
+	}
+
+	state.inputFile = input
+	state.inputOwned = owned
+	state.redirected &^= RedirectedInput
+
+	if state.terminal != nil {
+		state.terminal.input = input
+	}
+}
+
+// inputBusy reports whether the input is being read or is in raw mode, in
+// which case it can't be replaced: neither would follow the program.
+func (state *ProgramState) inputBusy() bool {
+	return state.input != nil || (state.terminal != nil && state.terminal.rawMode)
+}
+
+// openTTY opens the terminal device at path, such as "/dev/pts/3", once for
+// reading and once for writing.
+func openTTY(path string) (*os.File, *os.File, error) {
+	input, err := os.OpenFile(path, os.O_RDONLY, 0)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	output, err := os.OpenFile(path, os.O_WRONLY, 0)
+
+	if err != nil {
+		input.Close()
+		return nil, nil, err
+	}
+
+	return input, output, nil
+}
+
+//export tea_program_set_input_fd
+func tea_program_set_input_fd(programID C.ulonglong, fd C.int) C.int {
+	state := getProgram(uint64(programID))
+
+	if state == nil || state.inputBusy() {
+		return -1
+	}
+
+	file, err := openFD(int(fd), "input")
+
+	if err != nil {
+		return -1
+	}
+
+	state.setInput(file, true)
+
+	return 0
+}
+
+//export tea_program_open_tty
+func tea_program_open_tty(programID C.ulonglong, path *C.char) C.int {
+	state := getProgram(uint64(programID))
+
+	if state == nil || state.inputBusy() {
+		return -1
+	}
+
+	input, output, err := openTTY(C.GoString(path))
+
+	if err != nil {
+		return -1
+	}
+
+	state.setInput(input, true)
+	state.setOutput(output)
+
+	return 0
+}
+
+//export tea_terminal_redirected_streams
+func tea_terminal_redirected_streams(programID C.ulonglong) C.int {
+	state := getProgram(uint64(programID))
+
+	if state == nil {
+		return 0
+	}
+
+	return C.int(state.redirected)
+}
@@ -0,0 +1,131 @@
+package main
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+)
+
+// OutputWriter serializes everything written to an output. Each Write is one
+// logical operation — a frame, a mode toggle, an OSC sequence — that reaches
+// the output whole, so writes from different threads never interleave.
+// Writers pointed at stdout share one device lock, so programs on stdout and
+// functions that take no program don't interleave either.
+type OutputWriter struct {
+	mu     sync.Mutex
+	device *sync.Mutex
+	output io.Writer
+	stats  OutputStats
+}
+
+// OutputStats counts what went through an OutputWriter.
+type OutputStats struct {
+	Bytes      uint64 `json:"bytes"`
+	Operations uint64 `json:"operations"`
+	Errors     uint64 `json:"errors"`
+}
+
+// stdoutWriter serializes writes to stdout by programs without an output of
+// their own and by functions that take no program.
+var stdoutWriter = NewOutputWriter(os.Stdout)
+
+// stdoutDevice is the device lock of every writer pointed at stdout.
+var stdoutDevice sync.Mutex
+
+func NewOutputWriter(output io.Writer) *OutputWriter {
+	return &OutputWriter{device: deviceLock(output), output: output}
+}
+
+// deviceLock returns the lock that serializes writes to output across
+// writers: the shared one for stdout, otherwise one of the writer's own.
+func deviceLock(output io.Writer) *sync.Mutex {
+	if output == os.Stdout {
+		return &stdoutDevice
+	}
+
+	return &sync.Mutex{}
+}
+
+func (writer *OutputWriter) Write(data []byte) (int, error) {
+	if len(data) == 0 {
+		return 0, nil
+	}
+
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+
+	writer.device.Lock()
+	n, err := writer.output.Write(data)
+	writer.device.Unlock()
+
+	writer.stats.Bytes += uint64(n)
+	writer.stats.Operations++
+
+	if err != nil {
+		writer.stats.Errors++
+	}
+
+	return n, err
+}
+
+// setOutput points the writer at a new output once in-flight writes finish.
+func (writer *OutputWriter) setOutput(output io.Writer) {
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+
+	writer.device = deviceLock(output)
+	writer.output = output
+}
+
+func (writer *OutputWriter) Stats() OutputStats {
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+
+	return writer.stats
+}
+
+// Writer returns the serialized writer for the program's output.
+func (state *ProgramState) Writer() *OutputWriter {
+	if state == nil || state.writer == nil {
+		return stdoutWriter
+	}
+
+	return state.writer
+}
+
+func outputStats(writer *OutputWriter) *C.char {
+	jsonBytes, _ := json.Marshal(writer.Stats())
+	return C.CString(string(jsonBytes))
+}
+
+//export tea_program_output_stats
+func tea_program_output_stats(programID C.ulonglong) *C.char {
+	state := getProgram(uint64(programID))
+
+	if state == nil {
+		return C.CString("")
+	}
+
+	return outputStats(state.Writer())
+}
+
+//export tea_renderer_output_stats
+func tea_renderer_output_stats(id C.ulonglong) *C.char {
+	renderer := getRenderer(uint64(id))
+
+	if renderer == nil {
+		return C.CString("")
+	}
+
+	renderer.mu.Lock()
+	writer := renderer.Writer()
+	renderer.mu.Unlock()
+
+	return outputStats(writer)
+}
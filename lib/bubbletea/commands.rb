@@ -75,6 +75,21 @@ module Bubbletea
     end
   end
 
+  # Tells the renderer that rows top to bottom of the view (inclusive) moved
+  # up by lines, or down when lines is negative, so it can shift them on
+  # screen and only draw the newly exposed rows.
+  class ScrollCommand < Command
+    attr_reader :lines, :top, :bottom
+
+    def initialize(lines, top:, bottom:)
+      super()
+
+      @lines = lines
+      @top = top
+      @bottom = bottom
+    end
+  end
+
   class SuspendCommand < Command
   end
 
@@ -129,6 +144,14 @@ module Bubbletea
       PutsCommand.new(text)
     end
 
+    def scroll_up(lines, top:, bottom:)
+      ScrollCommand.new(lines, top: top, bottom: bottom)
+    end
+
+    def scroll_down(lines, top:, bottom:)
+      ScrollCommand.new(-lines, top: top, bottom: bottom)
+    end
+
     def suspend
       SuspendCommand.new
     end
@@ -61,14 +61,52 @@ module Bubbletea
     KEY_SHIFT_TAB = -24
     KEY_SPACE     = -25
 
-    attr_reader :key_type, :runes, :alt, :name
+    KEY_CTRL_I            = -26
+    KEY_CTRL_M            = -27
+    KEY_CTRL_OPEN_BRACKET = -28
+
+    KEY_F13 = -29
+    KEY_F14 = -30
+    KEY_F15 = -31
+    KEY_F16 = -32
+    KEY_F17 = -33
+    KEY_F18 = -34
+    KEY_F19 = -35
+    KEY_F20 = -36
+    KEY_F21 = -37
+    KEY_F22 = -38
+    KEY_F23 = -39
+    KEY_F24 = -40
 
-    def initialize(key_type:, runes: [], alt: false, name: nil)
+    ACTION_PRESS   = 0
+    ACTION_RELEASE = 1
+    ACTION_REPEAT  = 2
+
+    attr_reader :key_type, :runes, :alt, :shift, :ctrl, :meta, :keypad, :action, :name,
+                :super_key, :hyper, :caps_lock, :num_lock, :shifted_key, :base_key
+
+    # super_key, hyper, caps_lock, num_lock, shifted_key and base_key are only
+    # reported by terminals using the kitty keyboard protocol; shifted_key and
+    # base_key are codepoints, nil when not reported
+    def initialize(key_type:, runes: [], alt: false, shift: false, ctrl: false, meta: false, keypad: false,
+                   action: ACTION_PRESS, name: nil, super_key: false, hyper: false, caps_lock: false,
+                   num_lock: false, shifted_key: nil, base_key: nil)
       super()
 
       @key_type = key_type
       @runes = runes.is_a?(Array) ? runes : []
       @alt = alt
+      @shift = shift
+      @ctrl = ctrl
+      @meta = meta
+      @keypad = keypad
+      @action = action
+      @super_key = super_key
+      @hyper = hyper
+      @caps_lock = caps_lock
+      @num_lock = num_lock
+      @shifted_key = shifted_key
+      @base_key = base_key
       @name = name || lookup_key_name
     end
 
@@ -96,7 +134,7 @@ module Bubbletea
     end
 
     def ctrl?
-      @key_type.between?(0, 31)
+      @ctrl || @key_type.between?(0, 31)
     end
 
     def runes?
@@ -138,6 +176,18 @@ module Bubbletea
     def right?
       @key_type == KEY_RIGHT
     end
+
+    def press?
+      @action == ACTION_PRESS
+    end
+
+    def release?
+      @action == ACTION_RELEASE
+    end
+
+    def repeat?
+      @action == ACTION_REPEAT
+    end
   end
 
   class MouseMessage < Message
@@ -196,13 +246,38 @@ module Bubbletea
   end
 
   class WindowSizeMessage < Message
-    attr_reader :width, :height
+    attr_reader :width, :height, :pixel_width, :pixel_height
 
-    def initialize(width:, height:)
+    # Pixel sizes are 0 when the terminal doesn't report them
+    def initialize(width:, height:, pixel_width: 0, pixel_height: 0)
       super()
 
       @width = width
       @height = height
+      @pixel_width = pixel_width
+      @pixel_height = pixel_height
+    end
+
+    def cell_width
+      width.positive? ? pixel_width / width : 0
+    end
+
+    def cell_height
+      height.positive? ? pixel_height / height : 0
+    end
+  end
+
+  class PasteMessage < Message
+    attr_reader :content
+
+    def initialize(content:)
+      super()
+
+      @content = content
+    end
+
+    def to_s
+      @content
     end
   end
 
@@ -227,7 +302,18 @@ module Bubbletea
         key_type: hash["key_type"],
         runes: hash["runes"] || [],
         alt: hash["alt"] || false,
-        name: hash["name"]
+        shift: hash["shift"] || false,
+        ctrl: hash["ctrl"] || false,
+        meta: hash["meta"] || false,
+        keypad: hash["keypad"] || false,
+        action: hash["action"] || KeyMessage::ACTION_PRESS,
+        name: hash["name"],
+        super_key: hash["super"] || false,
+        hyper: hash["hyper"] || false,
+        caps_lock: hash["caps_lock"] || false,
+        num_lock: hash["num_lock"] || false,
+        shifted_key: hash["shifted_key"],
+        base_key: hash["base_key"]
       )
     when "mouse"
       MouseMessage.new(
@@ -239,10 +325,19 @@ module Bubbletea
         alt: hash["alt"] || false,
         ctrl: hash["ctrl"] || false
       )
+    when "paste"
+      PasteMessage.new(content: hash["content"] || "")
     when "focus"
       FocusMessage.new
     when "blur"
       BlurMessage.new
+    when "resize"
+      WindowSizeMessage.new(
+        width: hash["width"],
+        height: hash["height"],
+        pixel_width: hash["pixel_width"] || 0,
+        pixel_height: hash["pixel_height"] || 0
+      )
     end
   end
 end
@@ -7,6 +7,15 @@ module Bubbletea
   #   - update(message): Returns [model, command] - new state and optional command
   #   - view: Returns String - the current view to render
   #
+  # Optionally implement cursor to show the terminal's cursor in the view. It
+  # returns nil to hide it, or a Hash with x and y (relative to the view) and
+  # optional shape (:block, :underline or :bar), blink and color ("#rrggbb").
+  #
+  # Optionally implement layers to draw overlays such as dialogs over the view.
+  # It returns an Array of Hashes with content, x and y (relative to the view),
+  # and optional z (higher is drawn on top) and transparent (let unstyled
+  # spaces show the view underneath).
+  #
   # Example:
   #   class Counter
   #     include Bubbletea::Model
@@ -3,7 +3,7 @@
 module Bubbletea
   # Runner manages the event loop and coordinates between the model and the terminal
   class Runner
-    attr_reader :options
+    attr_reader :options, :capabilities, :program
 
     DEFAULT_OPTIONS = {
       alt_screen: false,
@@ -11,28 +11,42 @@ module Bubbletea
       mouse_all_motion: false,
       bracketed_paste: false,
       report_focus: false,
+      in_band_resize: false,
+      kitty_keyboard: false,
+      application_cursor: false,
+      application_keypad: false,
       fps: 60,
       input_timeout: 10,
+      query_timeout: 100,
+      escape_timeout: 50,
+      color_profile: nil,
+      renderer: :lines,
+      synchronized_output: nil,
       without_renderer: false,
+      input: nil,
+      output: nil,
+      tty: nil,
     }.freeze
 
     def initialize(model, **options)
       @model = model
       @options = DEFAULT_OPTIONS.merge(options)
-      @program = Program.new
+      @program = Program.new(input: @options[:input], output: @options[:output], tty: @options[:tty])
       @renderer_id = nil
       @running = false
       @pending_ticks = []
       @width = 80
       @height = 24
-      @resize_pending = false
-      @previous_winch_handler = nil
+      @pixel_width = 0
+      @pixel_height = 0
       @in_alt_screen = false
+      @capabilities = nil
     end
 
     def run
       setup_terminal
-      @renderer_id = @program.create_renderer unless @options[:without_renderer]
+      @renderer_id = @program.create_renderer(@options[:renderer]) unless @options[:without_renderer]
+      configure_renderer if @renderer_id
 
       update_terminal_size
       @running = true
@@ -43,7 +57,7 @@ module Bubbletea
 
       return unless @running
 
-      handle_message(WindowSizeMessage.new(width: @width, height: @height))
+      handle_message(WindowSizeMessage.new(width: @width, height: @height, pixel_width: @pixel_width, pixel_height: @pixel_height))
 
       render
       run_loop
@@ -62,7 +76,10 @@ module Bubbletea
     def setup_terminal
       @program.enter_raw_mode
       @program.hide_cursor
+      @program.set_escape_timeout(@options[:escape_timeout])
       @program.start_input_reader
+      # Nothing answers the probe when the output is a pipe or a file
+      @capabilities = @program.detect_capabilities(@options[:query_timeout]) if @program.output_tty?
 
       if @options[:alt_screen]
         @program.enter_alt_screen
@@ -74,21 +91,29 @@ module Bubbletea
       @program.enable_mouse_all_motion if @options[:mouse_all_motion]
       @program.enable_bracketed_paste if @options[:bracketed_paste]
       @program.enable_report_focus if @options[:report_focus]
-
-      setup_resize_handler
+      @program.enable_in_band_resize if @options[:in_band_resize]
+      @kitty_keyboard = kitty_keyboard?
+      @program.push_kitty_keyboard(kitty_keyboard_flags) if @kitty_keyboard
+      @program.enable_application_cursor if @options[:application_cursor]
+      @program.enable_application_keypad if @options[:application_keypad]
     end
 
     def cleanup_terminal
-      restore_resize_handler
+      @program.renderer_stop(@renderer_id) if @renderer_id
 
       @program.disable_mouse if @options[:mouse_cell_motion] || @options[:mouse_all_motion]
       @program.disable_bracketed_paste if @options[:bracketed_paste]
       @program.disable_report_focus if @options[:report_focus]
+      @program.disable_in_band_resize if @options[:in_band_resize]
+      @program.pop_kitty_keyboard if @kitty_keyboard
+      @program.disable_application_cursor if @options[:application_cursor]
+      @program.disable_application_keypad if @options[:application_keypad]
 
       if @in_alt_screen
         @program.exit_alt_screen
       else
-        print "\r\n"
+        # Leave the shell prompt below the frame, on the terminal the frame is on
+        @program.write("\r\n")
       end
 
       @program.show_cursor
@@ -96,31 +121,35 @@ module Bubbletea
       @program.exit_raw_mode
     end
 
-    def setup_resize_handler
-      @previous_winch_handler = Signal.trap("WINCH") do
-        @resize_pending = true
-        @previous_winch_handler.call if @previous_winch_handler.is_a?(Proc)
+    def configure_renderer
+      @program.renderer_set_color_profile(@renderer_id, @options[:color_profile]) if @options[:color_profile]
+
+      unless @options[:synchronized_output].nil?
+        @program.renderer_set_synchronized_output(@renderer_id, @options[:synchronized_output])
       end
-    rescue ArgumentError
-      # SIGWINCH not supported on this platform
-      @previous_winch_handler = nil
+
+      # Frames are written by the renderer's own ticker, render only hands over the view
+      @program.renderer_start(@renderer_id, @options[:fps])
     end
 
-    def restore_resize_handler
-      if @previous_winch_handler
-        Signal.trap("WINCH", @previous_winch_handler)
-      else
-        Signal.trap("WINCH", "DEFAULT")
-      end
-    rescue ArgumentError
-      # SIGWINCH not supported on this platform
+    # `kitty_keyboard: :auto` enables the protocol only when the terminal reported support for it
+    def kitty_keyboard?
+      return @capabilities&.dig("kitty_keyboard") == true if @options[:kitty_keyboard] == :auto
+
+      @options[:kitty_keyboard] ? true : false
+    end
+
+    # `kitty_keyboard: true` disambiguates escape codes, an Integer is used as the raw flags
+    def kitty_keyboard_flags
+      @options[:kitty_keyboard].is_a?(Integer) ? @options[:kitty_keyboard] : 1
     end
 
     def update_terminal_size
-      size = @program.terminal_size
+      size = @program.window_size
       return unless size
 
-      @width, @height = size
+      @width, @height = size[:width], size[:height]
+      @pixel_width, @pixel_height = size[:pixel_width], size[:pixel_height]
       @program.renderer_set_size(@renderer_id, @width, @height) if @renderer_id
     end
 
@@ -129,14 +158,19 @@ module Bubbletea
       last_frame = Time.now
 
       while @running
-        check_resize
         process_pending_messages
 
-        event = @program.poll_event(@options[:input_timeout])
-
-        if event
+        @program.poll_events(@options[:input_timeout]).each do |event|
           message = Bubbletea.parse_event(event)
-          handle_message(message) if message
+          next unless message
+
+          # The renderer was already resized when the event was queued
+          if message.is_a?(WindowSizeMessage)
+            @width, @height = message.width, message.height
+            @pixel_width, @pixel_height = message.pixel_width, message.pixel_height
+          end
+
+          handle_message(message)
         end
 
         process_ticks
@@ -150,26 +184,6 @@ module Bubbletea
       end
     end
 
-    def check_resize
-      return unless @resize_pending
-
-      @resize_pending = false
-
-      size = @program.terminal_size
-      return unless size
-
-      new_width, new_height = size
-
-      return if new_width == @width && new_height == @height
-
-      @width = new_width
-      @height = new_height
-
-      @program.renderer_set_size(@renderer_id, @width, @height) if @renderer_id
-
-      handle_message(WindowSizeMessage.new(width: @width, height: @height))
-    end
-
     def process_pending_messages
       return unless @pending_messages&.any?
 
@@ -225,10 +239,13 @@ module Bubbletea
         @in_alt_screen = false
 
       when SetWindowTitleCommand
-        Bubbletea._set_window_title(command.title)
+        @program.set_window_title(command.title)
 
       when PutsCommand
-        warn "\r#{command.text}\r"
+        print_line(command.text)
+
+      when ScrollCommand
+        @program.renderer_scroll(@renderer_id, command.top, command.bottom, command.lines) if @renderer_id
 
       when SuspendCommand
         suspend_process
@@ -281,10 +298,13 @@ module Bubbletea
         @in_alt_screen = false
 
       when SetWindowTitleCommand
-        Bubbletea._set_window_title(command.title)
+        @program.set_window_title(command.title)
 
       when PutsCommand
-        warn "\r#{command.text}\r"
+        print_line(command.text)
+
+      when ScrollCommand
+        @program.renderer_scroll(@renderer_id, command.top, command.bottom, command.lines) if @renderer_id
 
       when SuspendCommand
         suspend_process
@@ -349,38 +369,55 @@ module Bubbletea
     end
 
     def suspend_process
-      @program.disable_mouse if @options[:mouse_cell_motion] || @options[:mouse_all_motion]
-      @program.show_cursor
-      @program.stop_input_reader
-      @program.exit_raw_mode
+      release_terminal
 
       Process.kill("TSTP", Process.pid)
 
       # When we get here, we've been resumed (SIGCONT was received)
-      @program.enter_raw_mode
-      @program.hide_cursor
-      @program.start_input_reader
-      @program.enable_mouse_cell_motion if @options[:mouse_cell_motion]
-      @program.enable_mouse_all_motion if @options[:mouse_all_motion]
+      reacquire_terminal
 
       handle_message(ResumeMessage.new)
     end
 
     def exec_process(command)
+      release_terminal
+
+      command.callable.call
+
+      reacquire_terminal
+
+      handle_message(command.message) if command.message
+    end
+
+    # Hands the terminal to another process in the state a shell expects
+    def release_terminal
+      @program.renderer_pause(@renderer_id) if @renderer_id
       @program.disable_mouse if @options[:mouse_cell_motion] || @options[:mouse_all_motion]
+      @program.disable_application_cursor if @options[:application_cursor]
+      @program.disable_application_keypad if @options[:application_keypad]
       @program.show_cursor
       @program.stop_input_reader
       @program.exit_raw_mode
+    end
 
-      command.callable.call
-
+    def reacquire_terminal
       @program.enter_raw_mode
       @program.hide_cursor
       @program.start_input_reader
       @program.enable_mouse_cell_motion if @options[:mouse_cell_motion]
       @program.enable_mouse_all_motion if @options[:mouse_all_motion]
+      @program.enable_application_cursor if @options[:application_cursor]
+      @program.enable_application_keypad if @options[:application_keypad]
+      @program.renderer_resume(@renderer_id) if @renderer_id
+    end
 
-      handle_message(command.message) if command.message
+    # Lines go above the inline frame through the renderer, so it can redraw the frame below them
+    def print_line(text)
+      if @renderer_id
+        @program.renderer_println(@renderer_id, text)
+      else
+        @program.write("#{text}\r\n")
+      end
     end
 
     def render
@@ -388,7 +425,24 @@ module Bubbletea
       return unless @renderer_id
 
       view = @model.view
-      @program.render(@renderer_id, view)
+      update_cursor if @model.respond_to?(:cursor)
+      layers = @model.layers if @model.respond_to?(:layers)
+
+      if layers && !layers.empty?
+        @program.render_layers(@renderer_id, view, layers)
+      else
+        @program.render(@renderer_id, view)
+      end
+    end
+
+    def update_cursor
+      cursor = @model.cursor
+
+      if cursor
+        @program.renderer_set_cursor(@renderer_id, cursor[:x], cursor[:y], cursor[:shape], cursor[:blink], cursor[:color])
+      else
+        @program.renderer_hide_cursor(@renderer_id)
+      end
     end
   end
 
@@ -19,6 +19,40 @@ class TestBubbletea < Minitest::Spec
     assert_respond_to Bubbletea, :run
   end
 
+  it "compose draws layers over the view" do
+    view = Bubbletea.compose("hello\nworld", [{ content: "XY", x: 1, y: 1 }])
+
+    assert_equal "hello\nwXYld", view
+  end
+
+  it "compose orders layers by z and skips transparent spaces" do
+    layers = [
+      { content: "top", x: 0, y: 0, z: 2 },
+      { content: "a b c", x: 0, y: 0, z: 1, transparent: true },
+    ]
+
+    assert_equal "top-c", Bubbletea.compose("-----", layers)
+  end
+
+  it "compose keeps styles" do
+    view = Bubbletea.compose("\e[44mbase\e[0m", [{ content: "\e[1m!\e[0m", x: 1, y: 0 }])
+
+    assert_equal "\e[0;44mb\e[0;1m!\e[0;44mse\e[m", view
+  end
+
+  it "compose keeps lines no layer covers as they are" do
+    link = "\e]8;;https://example.com\e\\link\e]8;;\e\\\tend"
+    view = Bubbletea.compose("#{link}\nhello", [{ content: "XY", x: 1, y: 1 }])
+
+    assert_equal "#{link}\nhXYlo", view
+  end
+
+  it "compose rebuilds covered lines from their cells" do
+    view = Bubbletea.compose("\e]8;;https://example.com\e\\link\e]8;;\e\\", [{ content: "!", x: 4, y: 0 }])
+
+    assert_equal "link!", view
+  end
+
   it "quit returns quit command" do
     command = Bubbletea.quit
     assert_instance_of Bubbletea::QuitCommand, command
@@ -63,6 +97,15 @@ class TestBubbletea < Minitest::Spec
     assert_equal 2, command.commands.length
   end
 
+  it "scroll_up and scroll_down return scroll commands" do
+    up = Bubbletea.scroll_up(3, top: 1, bottom: 10)
+    down = Bubbletea.scroll_down(2, top: 1, bottom: 10)
+
+    assert_instance_of Bubbletea::ScrollCommand, up
+    assert_equal [3, 1, 10], [up.lines, up.top, up.bottom]
+    assert_equal(-2, down.lines)
+  end
+
   it "none returns nil" do
     assert_nil Bubbletea.none
   end
@@ -0,0 +1,314 @@
+# frozen_string_literal: true
+
+require "test_helper"
+
+class TestEmulator < Minitest::Spec
+  it "emulator screen text" do
+    emulator = Bubbletea::Emulator.new(20, 5)
+    emulator.write("Hello\r\nWorld\e[1;3H\e[K")
+
+    assert_equal "He\nWorld", emulator.screen_text
+  end
+
+  it "emulator cell at" do
+    emulator = Bubbletea::Emulator.new(20, 5)
+    emulator.write("\e[1;31mA\e[0m日")
+
+    assert_equal({ "content" => "A", "width" => 1, "style" => { "bold" => true, "foreground" => "31" } }, emulator.cell_at(0, 0))
+    assert_equal 2, emulator.cell_at(1, 0)["width"]
+    assert_nil emulator.cell_at(20, 0)
+  end
+
+  it "emulator blanks a wide grapheme overwritten one column off" do
+    emulator = Bubbletea::Emulator.new(10, 4)
+    emulator.write("x日\r日c")
+
+    assert_equal "日c", emulator.screen_text
+
+    emulator.write("\e[2J\e[H日日\e[1;2Ha")
+
+    assert_equal " a日", emulator.screen_text
+
+    emulator.write("\e[2J\e[Hx日z\e[1;3H\e[K")
+
+    assert_equal "x", emulator.screen_text
+  end
+
+  it "emulator alt screen and scroll region" do
+    emulator = Bubbletea::Emulator.new(10, 4)
+    emulator.write("main")
+    emulator.write("\e[?1049h\e[2;3r\e[3;1Ha\r\nb")
+
+    assert_equal "\na\nb", emulator.screen_text
+    assert emulator.state["alt_screen"]
+
+    emulator.write("\e[?1049l")
+
+    assert_equal "main", emulator.screen_text
+  end
+
+  it "emulator write and send_input keep bytes after a NUL" do
+    emulator = Bubbletea::Emulator.new(10, 4)
+    emulator.write("a\0b")
+
+    assert_equal "ab", emulator.screen_text
+
+    program = Bubbletea::Program.new(output: emulator)
+    program.start_input_reader
+    emulator.send_input("\0a")
+
+    events = program.poll_events(500)
+    events.concat(program.poll_events(100)) if events.length < 2
+
+    assert_equal ["ctrl+@", "a"], events.map { |event| Bubbletea.parse_event(event).to_s }
+  ensure
+    program&.stop_input_reader
+  end
+
+  it "emulator state" do
+    emulator = Bubbletea::Emulator.new(10, 4)
+    emulator.write("\e[?25l\e]2;title\a\e[2;4H")
+
+    state = emulator.state
+
+    assert_equal [3, 1], [state["cursor_x"], state["cursor_y"]]
+    refute state["cursor_visible"]
+    assert_equal "title", state["title"]
+  end
+
+  it "emulator input decodes to key messages" do
+    emulator = Bubbletea::Emulator.new(20, 5)
+    program = Bubbletea::Program.new(output: emulator)
+    program.start_input_reader
+
+    ctrl_up = poll_message(program, emulator, "\e[1;5A")
+    assert ctrl_up.up?
+    assert ctrl_up.ctrl
+    assert_equal "ctrl+up", ctrl_up.to_s
+
+    kitty = poll_message(program, emulator, "\e[105;5u")
+    assert_equal Bubbletea::KeyMessage::KEY_CTRL_I, kitty.key_type
+    assert kitty.ctrl
+
+    assert_equal "f1", poll_message(program, emulator, "\eOP").to_s
+    assert_equal "a", poll_message(program, emulator, "a").to_s
+  ensure
+    program&.stop_input_reader
+  end
+
+  it "emulator input decodes bracketed paste" do
+    emulator = Bubbletea::Emulator.new(20, 5)
+    program = Bubbletea::Program.new(output: emulator)
+    program.start_input_reader
+
+    paste = poll_message(program, emulator, "\e[200~x\e[201~")
+
+    assert_instance_of Bubbletea::PasteMessage, paste
+    assert_equal "x", paste.content
+  ensure
+    program&.stop_input_reader
+  end
+
+  it "resize while the input reader is stopped is reported on restart" do
+    emulator = Bubbletea::Emulator.new(20, 5)
+    program = Bubbletea::Program.new(output: emulator)
+    program.start_input_reader
+    program.stop_input_reader
+
+    emulator.resize(30, 6)
+    program.start_input_reader
+
+    message = Bubbletea.parse_event(program.poll_events(500).first)
+
+    assert_instance_of Bubbletea::WindowSizeMessage, message
+    assert_equal [30, 6], [message.width, message.height]
+  ensure
+    program&.stop_input_reader
+  end
+
+  it "emulator input decodes in-band resize reports" do
+    emulator = Bubbletea::Emulator.new(20, 5)
+    program = Bubbletea::Program.new(output: emulator)
+    program.start_input_reader
+
+    message = poll_message(program, emulator, "\e[48;24;80;480;800t")
+
+    assert_instance_of Bubbletea::WindowSizeMessage, message
+    assert_equal [80, 24, 800, 480], [message.width, message.height, message.pixel_width, message.pixel_height]
+    assert_equal [10, 20], [message.cell_width, message.cell_height]
+  ensure
+    program&.stop_input_reader
+  end
+
+  it "matching SIGWINCH and in-band report produce one resize event" do
+    emulator = Bubbletea::Emulator.new(20, 5)
+    program = Bubbletea::Program.new(output: emulator)
+    program.start_input_reader
+
+    emulator.resize(30, 6)
+    Process.kill("WINCH", Process.pid)
+    emulator.send_input("\e[48;6;30;0;0t")
+
+    events = []
+    deadline = Time.now + 0.5
+    events.concat(program.poll_events(50)) while Time.now < deadline
+
+    assert_equal [{ "width" => 30, "height" => 6 }],
+                 events.select { |event| event["type"] == "resize" }.map { |event| event.slice("width", "height") }
+  ensure
+    program&.stop_input_reader
+  end
+
+  it "resize is still reported after the size was read while the input reader was stopped" do
+    emulator = Bubbletea::Emulator.new(20, 5)
+    program = Bubbletea::Program.new(output: emulator)
+    program.start_input_reader
+    program.stop_input_reader
+
+    emulator.resize(30, 6)
+    assert_equal [30, 6], program.terminal_size
+    program.start_input_reader
+
+    message = Bubbletea.parse_event(program.poll_events(500).first)
+
+    assert_instance_of Bubbletea::WindowSizeMessage, message
+    assert_equal [30, 6], [message.width, message.height]
+  ensure
+    program&.stop_input_reader
+  end
+
+  it "creating a renderer keeps the known size" do
+    emulator = Bubbletea::Emulator.new(20, 5)
+    program = Bubbletea::Program.new(output: emulator)
+    program.start_input_reader
+    program.create_renderer
+    program.stop_input_reader
+    program.start_input_reader
+
+    assert_empty program.poll_events(100)
+  ensure
+    program&.stop_input_reader
+  end
+
+  it "emulator answers the program's queries" do
+    emulator = Bubbletea::Emulator.new(20, 5)
+    program = Bubbletea::Program.new(output: emulator)
+    program.start_input_reader
+    emulator.write("\e[2;4H")
+
+    assert_equal [3, 1], program.query_cursor_position(500)
+    assert_equal({ "type" => "primary_device_attributes", "attributes" => [62, 22] }, program.query_device_attributes(500))
+  ensure
+    program&.stop_input_reader
+  end
+
+  it "emulator can't be attached while input is read" do
+    reader, writer = IO.pipe
+    program = Bubbletea::Program.new(input: reader, output: :buffer)
+    program.start_input_reader
+
+    assert_raises(IOError) { program.attach_emulator(Bubbletea::Emulator.new(20, 5)) }
+  ensure
+    program&.stop_input_reader
+    reader&.close
+    writer&.close
+  end
+
+  it "program renders into an attached emulator" do
+    emulator = Bubbletea::Emulator.new(20, 5)
+    program = Bubbletea::Program.new
+    program.attach_emulator(emulator)
+
+    assert_equal [20, 5], program.terminal_size
+
+    renderer_id = program.create_renderer
+    program.renderer_set_size(renderer_id, 20, 5)
+    program.render(renderer_id, "one\n\e[32mtwo\e[0m")
+    program.render(renderer_id, "one\n\e[32mtwo\e[0m!")
+
+    assert_equal "one\ntwo!", emulator.screen_text
+    assert_equal "32", emulator.cell_at(0, 1)["style"]["foreground"]
+  end
+
+  it "program renders a full width line into an attached emulator" do
+    emulator = Bubbletea::Emulator.new(10, 3)
+    program = Bubbletea::Program.new
+    program.attach_emulator(emulator)
+
+    renderer_id = program.create_renderer
+    program.renderer_set_size(renderer_id, 10, 3)
+    program.render(renderer_id, "0123456789\nab")
+
+    assert_equal "0123456789\nab", emulator.screen_text
+  end
+
+  it "program renders a full width row into an attached emulator" do
+    emulator = Bubbletea::Emulator.new(10, 3)
+    program = Bubbletea::Program.new
+    program.attach_emulator(emulator)
+
+    renderer_id = program.create_renderer(:cells)
+    program.renderer_set_size(renderer_id, 10, 3)
+    program.render(renderer_id, "0123456789")
+    program.render(renderer_id, "0123456789\nab")
+
+    assert_equal "0123456789\nab", emulator.screen_text
+  end
+
+  it "paused renderer leaves the screen alone until resumed" do
+    emulator = Bubbletea::Emulator.new(10, 4)
+    program = Bubbletea::Program.new
+    program.attach_emulator(emulator)
+
+    renderer_id = program.create_renderer
+    program.renderer_set_size(renderer_id, 10, 4)
+    program.render(renderer_id, "one")
+    program.renderer_pause(renderer_id)
+    program.render(renderer_id, "two")
+
+    assert_equal "one", emulator.screen_text
+
+    program.renderer_resume(renderer_id)
+
+    assert_equal "one\ntwo", emulator.screen_text
+  end
+
+  it "program renders layers into an attached emulator" do
+    emulator = Bubbletea::Emulator.new(20, 5)
+    program = Bubbletea::Program.new
+    program.attach_emulator(emulator)
+
+    renderer_id = program.create_renderer
+    program.renderer_set_size(renderer_id, 20, 5)
+    program.render_layers(renderer_id, "one\ntwo\nthree", [{ content: "[ok]", x: 2, y: 1 }])
+
+    assert_equal "one\ntw[ok]\nthree", emulator.screen_text
+  end
+
+  it "program scrolls a region with a scroll hint" do
+    emulator = Bubbletea::Emulator.new(20, 6)
+    program = Bubbletea::Program.new
+    program.attach_emulator(emulator)
+
+    renderer_id = program.create_renderer
+    program.renderer_set_size(renderer_id, 20, 6)
+    program.renderer_set_alt_screen(renderer_id, true)
+    program.render(renderer_id, "top\n1\n2\n3\nbottom")
+
+    program.renderer_scroll(renderer_id, 1, 3, 1)
+    program.render(renderer_id, "top\n2\n3\n4\nbottom")
+
+    assert_equal "top\n2\n3\n4\nbottom", emulator.screen_text
+  end
+
+  private
+
+  def poll_message(program, emulator, input)
+    emulator.send_input(input)
+    events = program.poll_events(500)
+
+    assert_equal 1, events.length, "expected one event for #{input.inspect}, got #{events.inspect}"
+
+    Bubbletea.parse_event(events.first)
+  end
+end
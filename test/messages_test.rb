@@ -80,11 +80,38 @@ class TestKeyMsg < Minitest::Spec
     assert_equal "f12", f12.to_s
   end
 
+  it "key msg extended function keys" do
+    f13 = Bubbletea::KeyMessage.new(key_type: Bubbletea::KeyMessage::KEY_F13)
+    f24 = Bubbletea::KeyMessage.new(key_type: Bubbletea::KeyMessage::KEY_F24)
+
+    assert_equal "f13", f13.to_s
+    assert_equal "f24", f24.to_s
+  end
+
   it "key msg custom name" do
     message = Bubbletea::KeyMessage.new(key_type: Bubbletea::KeyMessage::KEY_RUNES, runes: [97], name: "custom")
     assert_equal "custom", message.to_s
   end
 
+  it "key msg actions" do
+    press = Bubbletea::KeyMessage.new(key_type: Bubbletea::KeyMessage::KEY_RUNES, runes: [97])
+    release = Bubbletea::KeyMessage.new(key_type: Bubbletea::KeyMessage::KEY_RUNES, runes: [97],
+                                        action: Bubbletea::KeyMessage::ACTION_RELEASE)
+    repeat = Bubbletea::KeyMessage.new(key_type: Bubbletea::KeyMessage::KEY_RUNES, runes: [97],
+                                       action: Bubbletea::KeyMessage::ACTION_REPEAT)
+
+    assert press.press?
+    assert release.release?
+    assert repeat.repeat?
+    refute release.press?
+  end
+
+  it "key msg ctrl i" do
+    message = Bubbletea::KeyMessage.new(key_type: Bubbletea::KeyMessage::KEY_CTRL_I, name: "ctrl+i")
+    refute message.tab?
+    assert_equal "ctrl+i", message.to_s
+  end
+
   it "key msg unicode char" do
     message = Bubbletea::KeyMessage.new(key_type: Bubbletea::KeyMessage::KEY_RUNES, runes: [128_522])
     assert_equal "😊", message.char
@@ -150,6 +177,22 @@ class TestWindowSizeMsg < Minitest::Spec
     message = Bubbletea::WindowSizeMessage.new(width: 80, height: 24)
     assert_equal 80, message.width
     assert_equal 24, message.height
+    assert_equal 0, message.pixel_width
+    assert_equal 0, message.cell_width
+  end
+
+  it "window size msg cell size" do
+    message = Bubbletea::WindowSizeMessage.new(width: 80, height: 24, pixel_width: 800, pixel_height: 480)
+    assert_equal 10, message.cell_width
+    assert_equal 20, message.cell_height
+  end
+end
+
+class TestPasteMessage < Minitest::Spec
+  it "paste message creation" do
+    message = Bubbletea::PasteMessage.new(content: "hello\nworld")
+    assert_equal "hello\nworld", message.content
+    assert_equal "hello\nworld", message.to_s
   end
 end
 
@@ -193,6 +236,49 @@ class TestParseEvent < Minitest::Spec
     assert message.alt
   end
 
+  it "parse key event with modifiers" do
+    event = { "type" => "key", "key_type" => Bubbletea::KeyMessage::KEY_LEFT, "shift" => true, "ctrl" => true,
+              "meta" => false, "name" => "ctrl+shift+left" }
+    message = Bubbletea.parse_event(event)
+    assert message.left?
+    assert message.shift
+    assert message.ctrl
+    assert message.ctrl?
+    refute message.meta
+    assert_equal "ctrl+shift+left", message.to_s
+  end
+
+  it "parse keypad key event" do
+    event = { "type" => "key", "key_type" => Bubbletea::KeyMessage::KEY_ENTER, "keypad" => true, "name" => "enter" }
+    message = Bubbletea.parse_event(event)
+    assert message.enter?
+    assert message.keypad
+  end
+
+  it "parse kitty key event" do
+    event = { "type" => "key", "key_type" => Bubbletea::KeyMessage::KEY_RUNES, "runes" => [97], "super" => true,
+              "hyper" => true, "caps_lock" => true, "num_lock" => true, "shifted_key" => 65, "base_key" => 97,
+              "name" => "super+hyper+a" }
+    message = Bubbletea.parse_event(event)
+    assert message.super_key
+    assert message.hyper
+    assert message.caps_lock
+    assert message.num_lock
+    assert_equal 65, message.shifted_key
+    assert_equal 97, message.base_key
+  end
+
+  it "parse key event without kitty fields" do
+    event = { "type" => "key", "key_type" => Bubbletea::KeyMessage::KEY_RUNES, "runes" => [97] }
+    message = Bubbletea.parse_event(event)
+    refute message.super_key
+    refute message.hyper
+    refute message.caps_lock
+    refute message.num_lock
+    assert_nil message.shifted_key
+    assert_nil message.base_key
+  end
+
   it "parse key event with name" do
     event = { "type" => "key", "key_type" => Bubbletea::KeyMessage::KEY_UP, "name" => "up" }
     message = Bubbletea.parse_event(event)
@@ -216,6 +302,13 @@ class TestParseEvent < Minitest::Spec
     assert message.ctrl
   end
 
+  it "parse paste event" do
+    event = { "type" => "paste", "content" => "pasted text" }
+    message = Bubbletea.parse_event(event)
+    assert_instance_of Bubbletea::PasteMessage, message
+    assert_equal "pasted text", message.content
+  end
+
   it "parse focus event" do
     event = { "type" => "focus" }
     message = Bubbletea.parse_event(event)
@@ -228,6 +321,22 @@ class TestParseEvent < Minitest::Spec
     assert_instance_of Bubbletea::BlurMessage, message
   end
 
+  it "parse resize event" do
+    event = { "type" => "resize", "width" => 120, "height" => 40 }
+    message = Bubbletea.parse_event(event)
+    assert_instance_of Bubbletea::WindowSizeMessage, message
+    assert_equal 120, message.width
+    assert_equal 40, message.height
+  end
+
+  it "parse resize event with pixels" do
+    event = { "type" => "resize", "width" => 80, "height" => 24, "pixel_width" => 800, "pixel_height" => 480 }
+    message = Bubbletea.parse_event(event)
+    assert_equal 800, message.pixel_width
+    assert_equal 480, message.pixel_height
+    assert_equal 10, message.cell_width
+  end
+
   it "parse unknown event" do
     event = { "type" => "unknown" }
     message = Bubbletea.parse_event(event)
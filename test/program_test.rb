@@ -20,6 +20,16 @@ class TestProgram < Minitest::Spec
     assert_kind_of Integer, size[1]
   end
 
+  it "program window size" do
+    program = Bubbletea::Program.new
+    size = program.window_size
+
+    return unless size
+
+    assert_equal [:width, :height, :pixel_width, :pixel_height], size.keys
+    assert(size.values.all? { |value| value.is_a?(Integer) })
+  end
+
   it "program create renderer" do
     program = Bubbletea::Program.new
     renderer_id = program.create_renderer
@@ -27,6 +37,148 @@ class TestProgram < Minitest::Spec
     assert renderer_id.positive?
   end
 
+  it "program create cell renderer" do
+    program = Bubbletea::Program.new
+
+    assert_kind_of Integer, program.create_renderer(:cells)
+    assert_raises(ArgumentError) { program.create_renderer(:pixels) }
+  end
+
+  it "program writes to an output buffer" do
+    program = Bubbletea::Program.new
+    program.set_output(:buffer)
+    program.hide_cursor
+
+    renderer_id = program.create_renderer
+    program.render(renderer_id, "Hello, \e[1mWorld\e[0m")
+
+    output = program.read_output
+
+    assert_includes output, "\e[?25l"
+    assert_includes output, "Hello, \e[1mWorld\e[0m"
+    assert_equal "", program.read_output
+  end
+
+  it "program renderer writes to its own output buffer" do
+    program = Bubbletea::Program.new
+    renderer_id = program.create_renderer
+    program.renderer_set_output(renderer_id, :buffer)
+    program.renderer_set_color_profile(renderer_id, :truecolor)
+
+    program.render(renderer_id, "\e[31mred\e[0m")
+
+    assert_includes program.renderer_read_output(renderer_id), "\e[31mred\e[0m"
+  end
+
+  it "program redirected streams" do
+    program = Bubbletea::Program.new
+    streams = program.redirected_streams
+
+    assert_instance_of Array, streams
+    assert_empty streams - [:input, :output]
+
+    program.set_output(:buffer)
+
+    refute_includes program.redirected_streams, :output
+  end
+
+  it "program created with an output buffer" do
+    program = Bubbletea::Program.new(output: :buffer)
+    program.set_window_title("Title")
+    program.clear_screen
+
+    assert_equal "\e]2;Title\a\e[2J\e[H", program.read_output
+  end
+
+  it "program output to a buffer is not a tty" do
+    program = Bubbletea::Program.new(output: :buffer)
+
+    refute program.output_tty?
+  end
+
+  it "program output to an emulator answers queries like a tty" do
+    emulator = Bubbletea::Emulator.new(20, 5)
+    program = Bubbletea::Program.new(output: emulator)
+
+    assert program.output_tty?
+  end
+
+  it "program writes text to its output" do
+    program = Bubbletea::Program.new(output: :buffer)
+    program.write("one\r\n")
+
+    assert_equal "one\r\n", program.read_output
+  end
+
+  it "program output keeps NUL bytes" do
+    program = Bubbletea::Program.new(output: :buffer)
+    program.write("a\0b")
+
+    assert_equal "a\0b", program.read_output
+  end
+
+  it "program reads input from a file descriptor" do
+    reader, writer = IO.pipe
+    program = Bubbletea::Program.new(input: reader, output: :buffer)
+
+    refute program.tty?
+  ensure
+    reader&.close
+    writer&.close
+  end
+
+  it "program rejects unknown terminals" do
+    assert_raises(IOError) { Bubbletea::Program.new(tty: "/nonexistent/tty") }
+  end
+
+  it "program output stats" do
+    program = Bubbletea::Program.new(output: :buffer)
+    program.hide_cursor
+    program.enable_mouse_cell_motion
+
+    stats = program.output_stats
+
+    assert_equal program.read_output.bytesize, stats["bytes"]
+    assert_equal 2, stats["operations"]
+    assert_equal 0, stats["errors"]
+  end
+
+  it "program renderer output stats" do
+    program = Bubbletea::Program.new
+    renderer_id = program.create_renderer
+    program.renderer_set_output(renderer_id, :buffer)
+    program.render(renderer_id, "Hello")
+
+    assert_equal 1, program.renderer_output_stats(renderer_id)["operations"]
+  end
+
+  it "program rejects unknown outputs" do
+    program = Bubbletea::Program.new
+
+    assert_raises(ArgumentError) { program.set_output("stdout") }
+  end
+
+  it "program renderer color profile" do
+    program = Bubbletea::Program.new
+    renderer_id = program.create_renderer
+
+    program.renderer_set_color_profile(renderer_id, :ansi256)
+    assert_equal "ansi256", program.renderer_color_profile(renderer_id)
+
+    assert_raises(ArgumentError) { program.renderer_set_color_profile(renderer_id, "sepia") }
+  end
+
+  it "program renderer synchronized output" do
+    program = Bubbletea::Program.new
+    renderer_id = program.create_renderer
+
+    program.renderer_set_synchronized_output(renderer_id, true)
+    assert program.renderer_synchronized_output?(renderer_id)
+
+    program.renderer_set_synchronized_output(renderer_id, false)
+    refute program.renderer_synchronized_output?(renderer_id)
+  end
+
   it "program string width" do
     program = Bubbletea::Program.new
 
@@ -40,6 +192,14 @@ class TestProgram < Minitest::Spec
   it "program responds to terminal methods" do
     program = Bubbletea::Program.new
 
+    assert_respond_to program, :set_output
+    assert_respond_to program, :read_output
+    assert_respond_to program, :output_stats
+    assert_respond_to program, :set_input
+    assert_respond_to program, :open_tty
+    assert_respond_to program, :tty?
+    assert_respond_to program, :set_window_title
+    assert_respond_to program, :clear_screen
     assert_respond_to program, :enter_raw_mode
     assert_respond_to program, :exit_raw_mode
     assert_respond_to program, :enter_alt_screen
@@ -53,6 +213,14 @@ class TestProgram < Minitest::Spec
     assert_respond_to program, :disable_bracketed_paste
     assert_respond_to program, :enable_report_focus
     assert_respond_to program, :disable_report_focus
+    assert_respond_to program, :enable_in_band_resize
+    assert_respond_to program, :disable_in_band_resize
+    assert_respond_to program, :push_kitty_keyboard
+    assert_respond_to program, :pop_kitty_keyboard
+    assert_respond_to program, :enable_application_cursor
+    assert_respond_to program, :disable_application_cursor
+    assert_respond_to program, :enable_application_keypad
+    assert_respond_to program, :disable_application_keypad
   end
 
   it "program responds to input methods" do
@@ -60,8 +228,24 @@ class TestProgram < Minitest::Spec
 
     assert_respond_to program, :start_input_reader
     assert_respond_to program, :stop_input_reader
+    assert_respond_to program, :set_escape_timeout
     assert_respond_to program, :read_raw_input
     assert_respond_to program, :poll_event
+    assert_respond_to program, :poll_events
+  end
+
+  it "program responds to terminal query methods" do
+    program = Bubbletea::Program.new
+
+    assert_respond_to program, :query_cursor_position
+    assert_respond_to program, :query_device_attributes
+    assert_respond_to program, :query_secondary_device_attributes
+    assert_respond_to program, :query_terminal_version
+    assert_respond_to program, :query_mode
+    assert_respond_to program, :query_background_color
+    assert_respond_to program, :query_foreground_color
+    assert_respond_to program, :has_dark_background?
+    assert_respond_to program, :detect_capabilities
   end
 
   it "program responds to renderer methods" do
@@ -72,5 +256,21 @@ class TestProgram < Minitest::Spec
     assert_respond_to program, :renderer_set_size
     assert_respond_to program, :renderer_set_alt_screen
     assert_respond_to program, :renderer_clear
+    assert_respond_to program, :renderer_set_color_profile
+    assert_respond_to program, :renderer_color_profile
+    assert_respond_to program, :renderer_println
+    assert_respond_to program, :renderer_printf
+    assert_respond_to program, :renderer_set_cursor
+    assert_respond_to program, :renderer_hide_cursor
+    assert_respond_to program, :renderer_set_output
+    assert_respond_to program, :renderer_read_output
+    assert_respond_to program, :renderer_output_stats
+    assert_respond_to program, :renderer_start
+    assert_respond_to program, :renderer_flush
+    assert_respond_to program, :renderer_stop
+    assert_respond_to program, :renderer_pause
+    assert_respond_to program, :renderer_resume
+    assert_respond_to program, :renderer_set_synchronized_output
+    assert_respond_to program, :renderer_synchronized_output?
   end
 end
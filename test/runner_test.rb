@@ -19,7 +19,7 @@ class TestRunner < Minitest::Spec
     assert_equal 80, runner.instance_variable_get(:@width)
     assert_equal 24, runner.instance_variable_get(:@height)
     refute runner.instance_variable_get(:@running)
-    refute runner.instance_variable_get(:@resize_pending)
+    assert_nil runner.capabilities
   end
 
   it "runner default options" do
@@ -32,8 +32,22 @@ class TestRunner < Minitest::Spec
     refute options[:mouse_all_motion]
     refute options[:bracketed_paste]
     refute options[:report_focus]
+    refute options[:in_band_resize]
     assert_equal 60, options[:fps]
     assert_equal 10, options[:input_timeout]
+    assert_equal 50, options[:escape_timeout]
+  end
+
+  it "runner enables the kitty keyboard protocol automatically only when it is supported" do
+    runner = Bubbletea::Runner.new(DummyModel.new, kitty_keyboard: :auto)
+
+    refute runner.__send__(:kitty_keyboard?)
+
+    runner.instance_variable_set(:@capabilities, { "kitty_keyboard" => true })
+    assert runner.__send__(:kitty_keyboard?)
+
+    runner.instance_variable_set(:@capabilities, { "kitty_keyboard" => false })
+    refute runner.__send__(:kitty_keyboard?)
   end
 
   it "runner custom options" do
@@ -161,6 +175,48 @@ class TestRunnerCommandProcessing < Minitest::Spec
     @runner.__send__(:process_command, nil)
   end
 
+  it "process puts command prints through the renderer" do
+    printed = []
+
+    program = Object.new
+    program.define_singleton_method(:renderer_println) { |renderer_id, text| printed << [renderer_id, text] }
+
+    @runner.instance_variable_set(:@program, program)
+    @runner.instance_variable_set(:@renderer_id, 7)
+
+    @runner.__send__(:process_command, Bubbletea.puts("Installed rake"))
+
+    assert_equal [[7, "Installed rake"]], printed
+  end
+
+  it "process puts command without a renderer writes to the program's output" do
+    written = []
+
+    program = Object.new
+    program.define_singleton_method(:write) { |data| written << data }
+
+    @runner.instance_variable_set(:@program, program)
+    @runner.instance_variable_set(:@renderer_id, nil)
+
+    @runner.__send__(:process_command, Bubbletea.puts("Installed rake"))
+
+    assert_equal ["Installed rake\r\n"], written
+  end
+
+  it "process scroll command hints the renderer" do
+    hints = []
+
+    program = Object.new
+    program.define_singleton_method(:renderer_scroll) { |*args| hints << args }
+
+    @runner.instance_variable_set(:@program, program)
+    @runner.instance_variable_set(:@renderer_id, 7)
+
+    @runner.__send__(:process_command, Bubbletea.scroll_down(2, top: 1, bottom: 5))
+
+    assert_equal [[7, 1, 5, -2]], hints
+  end
+
   it "process exec command calls callable" do
     called = false
     callable = -> { called = true }
@@ -195,4 +251,29 @@ class TestRunnerCommandProcessing < Minitest::Spec
     assert called
     assert_includes @model.messages, :exec_done
   end
+
+  it "process exec command resets cursor and keypad modes around the callable" do
+    calls = []
+
+    program = Object.new
+    [
+      :disable_mouse, :show_cursor, :stop_input_reader, :exit_raw_mode, :enter_raw_mode, :hide_cursor, :start_input_reader,
+      :enable_application_cursor, :disable_application_cursor, :enable_application_keypad, :disable_application_keypad,
+    ].each do |method|
+      program.define_singleton_method(method) { calls << method }
+    end
+
+    runner = Bubbletea::Runner.new(@model, application_cursor: true, application_keypad: true)
+    runner.instance_variable_set(:@running, true)
+    runner.instance_variable_set(:@program, program)
+
+    runner.__send__(:process_command, Bubbletea.exec(-> { calls << :callable }))
+
+    callable = calls.index(:callable)
+
+    assert_operator calls.index(:disable_application_cursor), :<, callable
+    assert_operator calls.index(:disable_application_keypad), :<, callable
+    assert_operator calls.index(:enable_application_cursor), :>, callable
+    assert_operator calls.index(:enable_application_keypad), :>, callable
+  end
 end